@@ -0,0 +1,126 @@
+package xf
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// errorCodeKey is set by respondError, so that access logs carry the error code.
+const errorCodeKey = "xf_error_code"
+
+// AccessLogPolicy decides which requests are logged. Non-2xx and slow requests are always logged.
+type AccessLogPolicy struct {
+	// SuccessSampleRate is the fraction of 2xx responses logged, in [0, 1].
+	SuccessSampleRate float64
+	// SkipPathPrefixes skip requests whose path has any of the prefixes, e.g. "/metrics".
+	SkipPathPrefixes []string
+	// SkipPathPatterns skip requests whose path matches any of the regular expressions.
+	SkipPathPatterns []string
+}
+
+// DefaultAccessLogPolicy logs all requests except metrics.
+func DefaultAccessLogPolicy() AccessLogPolicy {
+	return AccessLogPolicy{
+		SuccessSampleRate: 1,
+		SkipPathPrefixes:  []string{"/metrics"},
+	}
+}
+
+// StructuredGinLogger logs requests through zap with module "access". See LoggerConfig.Structured.
+func StructuredGinLogger(policy AccessLogPolicy) gin.HandlerFunc {
+	return LoggerWithConfig(LoggerConfig{Structured: true, Policy: &policy})
+}
+
+type accessLogPolicy struct {
+	AccessLogPolicy
+	patterns []*regexp.Regexp
+}
+
+func compileAccessLogPolicy(policy *AccessLogPolicy) *accessLogPolicy {
+	if policy == nil {
+		return nil
+	}
+	p := &accessLogPolicy{AccessLogPolicy: *policy}
+	for _, pattern := range policy.SkipPathPatterns {
+		p.patterns = append(p.patterns, regexp.MustCompile(pattern))
+	}
+	return p
+}
+
+func (r *accessLogPolicy) skipPath(path string) bool {
+	for _, prefix := range r.SkipPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	for _, pattern := range r.patterns {
+		if pattern.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *accessLogPolicy) shouldLog(status int, latency time.Duration) bool {
+	if status < 200 || status >= 300 || latency >= SlowGinRequestLatencyThreshold {
+		return true
+	}
+	return r.SuccessSampleRate >= 1 || (r.SuccessSampleRate > 0 && rand.Float64() < r.SuccessSampleRate)
+}
+
+// logAccess writes an access log at info level, warn for 4xx and error for 5xx.
+func logAccess(c *gin.Context, traceID string, param LogFormatterParams) {
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	// -1 if nothing written
+	responseSize := param.BodySize
+	if responseSize < 0 {
+		responseSize = 0
+	}
+
+	fields := []zap.Field{
+		zap.String(LogFieldTraceID, traceID),
+		zap.String(LogFieldRoute, route),
+		zap.String("method", param.Method),
+		zap.String("path", param.Path),
+		zap.Int("status", param.StatusCode),
+		zap.Float64("latency_ms", float64(param.Latency.Nanoseconds())/1e6),
+		zap.Int64("request_size", c.Request.ContentLength),
+		zap.Int("response_size", responseSize),
+		zap.String("client_ip", param.ClientIP),
+	}
+	if p := getCTX(c).Principal(); p != nil {
+		fields = append(fields, zap.String(LogFieldPrincipal, p.ID))
+		if p.Tenant != "" {
+			fields = append(fields, zap.String(LogFieldTenant, p.Tenant))
+		}
+	}
+	if code, ok := c.Get(errorCodeKey); ok {
+		fields = append(fields, zap.Any("error_code", code))
+	}
+	if param.ErrorMessage != "" {
+		fields = append(fields, zap.String("error", param.ErrorMessage))
+	}
+	if param.Latency >= SlowGinRequestLatencyThreshold {
+		fields = append(fields, zap.Bool("slow", true))
+	}
+
+	level := zapcore.InfoLevel
+	if param.StatusCode >= 500 {
+		level = zapcore.ErrorLevel
+	} else if param.StatusCode >= 400 {
+		level = zapcore.WarnLevel
+	}
+
+	if ce := ModuleLogger("access").Check(level, "access"); ce != nil {
+		ce.Write(fields...)
+	}
+}
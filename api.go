@@ -13,6 +13,9 @@ type API[T any] struct {
 
 	Auth2JSON map[string]string
 
+	// 查看标记了 xf:"mask:xxx" 的字段完整值所需的权限，不填使用DefaultUnmaskPermission。
+	UnmaskPermission string
+
 	PageGetter  func(h *GinHelper, req *PageMeta) []*T
 	ListGetter  func(h *GinHelper, req *PageMeta) []*T
 	CountGetter func(h *GinHelper, req *PageMeta) int64
@@ -56,6 +59,7 @@ func (r *API[T]) getPage(c *gin.Context) {
 	req := r.MustGetPageReq(h)
 
 	data := r.PageGetter(h, req)
+	r.maskOutput(h, data)
 
 	resp := &PageResp[T]{
 		PageMeta: req,
@@ -70,6 +74,7 @@ func (r *API[T]) getList(c *gin.Context) {
 	req := r.MustGetPageReq(h)
 
 	data := r.ListGetter(h, req)
+	r.maskOutput(h, data)
 
 	h.RespondKV200(r.ListName, data, nil)
 }
@@ -130,10 +135,16 @@ func (r *API[T]) get(c *gin.Context) {
 	req := r.MustGetJSONReq(h)
 
 	data := r.Getter(h, req)
+	r.maskOutput(h, data)
 
 	h.RespondKV200(r.ItemName, data, nil)
 }
 
+// maskOutput unmasks only for verified principals, see SetVerifiedClaims. Unverified JWT is never trusted here.
+func (r *API[T]) maskOutput(h *GinHelper, data any) {
+	MaskOutput(h.CTX(), r.UnmaskPermission, data)
+}
+
 func (r *API[T]) MustGetJSONReq(h *GinHelper) map[string]interface{} {
 	m, et := h.UnmarshalJSONToMap()
 	if et != nil {
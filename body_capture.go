@@ -0,0 +1,220 @@
+package xf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodyCaptureOptions configures BodyCaptureMiddleware.
+type BodyCaptureOptions struct {
+	// MaxRequestBody is the max bytes of request body captured. Defaults to MaxLengthOfRequestDump.
+	MaxRequestBody int
+	// CaptureResponse captures response body up to MaxResponseBody bytes, which defaults to MaxLengthOfRequestDump.
+	CaptureResponse bool
+	MaxResponseBody int
+}
+
+// CapturedBody is a bounded copy of a request or response body, as it's read or written by handlers.
+type CapturedBody struct {
+	Bytes []byte
+	// Truncated is true if the body is longer than Bytes.
+	Truncated bool
+}
+
+// BodyCaptureMiddleware tees request body (and optionally response body) into bounded buffers on CTX.
+// See CTX.RequestBody and CTX.ResponseBody. Use it before handlers reading body, and after middlewares
+// replacing body or writer, e.g. gzip.
+// Without it, GinMiddleware and GinLogger capture request body with the default options.
+func BodyCaptureMiddleware(opts BodyCaptureOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := getCTX(c)
+		captureRequestBody(c, ctx, opts.MaxRequestBody)
+
+		if opts.CaptureResponse && ctx.responseBody == nil {
+			w := &responseBodyCapture{ResponseWriter: c.Writer, limit: opts.MaxResponseBody}
+			if w.limit <= 0 {
+				w.limit = MaxLengthOfRequestDump
+			}
+			c.Writer = w
+			ctx.responseBody = w
+		}
+
+		c.Next()
+	}
+}
+
+// captureRequestBody wraps request body of c once. Limit of an existing capture is raised to limit if it's positive.
+func captureRequestBody(c *gin.Context, ctx *CTX, limit int) {
+	if ctx.requestBody != nil {
+		if limit > 0 {
+			ctx.requestBody.raiseLimit(limit)
+		}
+		return
+	}
+	if limit <= 0 {
+		limit = MaxLengthOfRequestDump
+	}
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		return
+	}
+	capture := &requestBodyCapture{src: c.Request.Body, limit: limit}
+	c.Request.Body = capture
+	ctx.requestBody = capture
+}
+
+// RequestBody returns captured request body. Bytes not read by handlers yet are read ahead up to the limit,
+// and are still readable by handlers. Returns nil if request has no body, or it's not a http request.
+func (c *CTX) RequestBody() *CapturedBody {
+	if c == nil || c.requestBody == nil {
+		return nil
+	}
+	return c.requestBody.captured()
+}
+
+// ResponseBody returns response body written so far. Returns nil if it's not captured. See BodyCaptureOptions.
+func (c *CTX) ResponseBody() *CapturedBody {
+	if c == nil || c.responseBody == nil {
+		return nil
+	}
+	return c.responseBody.captured()
+}
+
+// requestBodyCapture is a request body keeping the first limit bytes read.
+type requestBodyCapture struct {
+	src   io.ReadCloser
+	limit int
+
+	lock sync.Mutex
+	buf  []byte
+	// pending is read ahead by captured() but not read by handlers yet.
+	pending   []byte
+	err       error
+	truncated bool
+}
+
+func (r *requestBodyCapture) Read(p []byte) (n int, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(r.pending) > 0 {
+		n = copy(p, r.pending)
+		r.pending = r.pending[n:]
+		return n, nil
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err = r.src.Read(p)
+	r.capture(p[:n])
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *requestBodyCapture) Close() error {
+	return r.src.Close()
+}
+
+// capture appends b to buf within limit. Caller must hold the lock.
+func (r *requestBodyCapture) capture(b []byte) {
+	room := r.limit - len(r.buf)
+	if len(b) > room {
+		r.truncated = true
+		if room <= 0 {
+			return
+		}
+		b = b[:room]
+	}
+	r.buf = append(r.buf, b...)
+}
+
+func (r *requestBodyCapture) raiseLimit(limit int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// bytes beyond the old limit might have been read by handlers, so a truncated capture can't be extended.
+	if limit > r.limit && !r.truncated {
+		r.limit = limit
+	}
+}
+
+func (r *requestBodyCapture) captured() *CapturedBody {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// read ahead until limit+1 bytes, so that truncation is known.
+	for r.err == nil && !r.truncated {
+		tmp := make([]byte, r.limit-len(r.buf)+1)
+		n, err := r.src.Read(tmp)
+		r.pending = append(r.pending, tmp[:n]...)
+		r.capture(tmp[:n])
+		if err != nil {
+			r.err = err
+		}
+	}
+
+	return &CapturedBody{Bytes: append([]byte(nil), r.buf...), Truncated: r.truncated}
+}
+
+// responseBodyCapture is a gin.ResponseWriter keeping the first limit bytes written.
+type responseBodyCapture struct {
+	gin.ResponseWriter
+	limit int
+
+	lock      sync.Mutex
+	buf       []byte
+	truncated bool
+}
+
+func (r *responseBodyCapture) Write(b []byte) (int, error) {
+	r.capture(b)
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseBodyCapture) WriteString(s string) (int, error) {
+	r.capture([]byte(s))
+	return r.ResponseWriter.WriteString(s)
+}
+
+func (r *responseBodyCapture) capture(b []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	room := r.limit - len(r.buf)
+	if len(b) > room {
+		r.truncated = true
+		if room <= 0 {
+			return
+		}
+		b = b[:room]
+	}
+	r.buf = append(r.buf, b...)
+}
+
+func (r *responseBodyCapture) captured() *CapturedBody {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return &CapturedBody{Bytes: append([]byte(nil), r.buf...), Truncated: r.truncated}
+}
+
+// decodedBody decompresses gzip body for logs. A truncated body is decompressed as much as possible.
+func decodedBody(header http.Header, body []byte) []byte {
+	if !strings.Contains(strings.ToLower(header.Get("Content-Encoding")), "gzip") {
+		return body
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return body
+	}
+	decoded, _ := io.ReadAll(io.LimitReader(zr, int64(MaxLengthOfRequestDump)*4))
+	return decoded
+}
@@ -0,0 +1,356 @@
+package xf
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+var ErrDefCircuitOpen = RegisterError(ErrorDef{
+	Code:        "CircuitOpen",
+	Status:      503,
+	Message:     "circuit %v is open",
+	Description: "A downstream service is failing. Calls fail fast until it recovers.",
+})
+
+var (
+	circuitStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "xf_circuit_breaker_state",
+		Help: "State of circuit breaker. 0 closed, 1 open, 2 half-open.",
+	}, []string{"name"})
+
+	circuitRejectedCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "xf_circuit_breaker_rejected_total",
+		Help: "Total number of calls rejected by open circuit breaker.",
+	}, []string{"name"})
+
+	circuitTransitionCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "xf_circuit_breaker_transitions_total",
+		Help: "Total number of state transitions of circuit breaker.",
+	}, []string{"name", "state"})
+)
+
+func init() {
+	prometheus.MustRegister(circuitStateGauge, circuitRejectedCounter, circuitTransitionCounter)
+}
+
+// CircuitBreakerOptions configures CircuitBreaker. See DefaultCircuitBreakerOptions.
+type CircuitBreakerOptions struct {
+	// Window is the fixed window of counting requests and failures in closed state.
+	Window time.Duration
+	// MinRequests in a window before the circuit can open.
+	MinRequests int
+	// FailureRate in (0, 1] to open the circuit.
+	FailureRate float64
+	// OpenTimeout is the time to stay open, then half-open.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probes in half-open state. All succeeded closes the circuit, any failed opens it.
+	HalfOpenRequests int
+
+	// IsGRPCFailure decides if an error of grpc call counts as failure. See IsGRPCFailure.
+	IsGRPCFailure func(err error) bool
+	// IsHTTPFailure decides if a result of http call counts as failure. See IsHTTPFailure.
+	IsHTTPFailure func(resp *http.Response, err error) bool
+	// HTTPKey names the breaker of an http request. Default is the host.
+	HTTPKey func(req *http.Request) string
+}
+
+func DefaultCircuitBreakerOptions() CircuitBreakerOptions {
+	return CircuitBreakerOptions{
+		Window:           10 * time.Second,
+		MinRequests:      20,
+		FailureRate:      0.5,
+		OpenTimeout:      5 * time.Second,
+		HalfOpenRequests: 1,
+		IsGRPCFailure:    IsGRPCFailure,
+		IsHTTPFailure:    IsHTTPFailure,
+		HTTPKey: func(req *http.Request) string {
+			return req.URL.Host
+		},
+	}
+}
+
+// withDefaults fills zero fields from DefaultCircuitBreakerOptions, so that partially filled options work.
+func (r CircuitBreakerOptions) withDefaults() CircuitBreakerOptions {
+	d := DefaultCircuitBreakerOptions()
+	if r.Window <= 0 {
+		r.Window = d.Window
+	}
+	if r.MinRequests <= 0 {
+		r.MinRequests = d.MinRequests
+	}
+	if r.FailureRate <= 0 || r.FailureRate > 1 {
+		r.FailureRate = d.FailureRate
+	}
+	if r.OpenTimeout <= 0 {
+		r.OpenTimeout = d.OpenTimeout
+	}
+	if r.HalfOpenRequests <= 0 {
+		r.HalfOpenRequests = d.HalfOpenRequests
+	}
+	if r.IsGRPCFailure == nil {
+		r.IsGRPCFailure = d.IsGRPCFailure
+	}
+	if r.IsHTTPFailure == nil {
+		r.IsHTTPFailure = d.IsHTTPFailure
+	}
+	if r.HTTPKey == nil {
+		r.HTTPKey = d.HTTPKey
+	}
+	return r
+}
+
+// IsGRPCFailure returns true if the downstream service seems unhealthy. Errors caused by caller, such as InvalidArgument and NotFound, are not failures.
+func IsGRPCFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// IsHTTPFailure returns true on transport error or 5xx.
+func IsHTTPFailure(resp *http.Response, err error) bool {
+	return err != nil || (resp != nil && resp.StatusCode >= 500)
+}
+
+// CircuitBreaker fails fast when failure rate of calls exceeds threshold. It's safe for concurrent use.
+type CircuitBreaker struct {
+	name string
+	opts CircuitBreakerOptions
+
+	lock        sync.Mutex
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int // probes in flight or succeeded in half-open state
+	succeeded   int
+}
+
+// NewCircuitBreaker creates a closed breaker. Zero fields of opts are filled from DefaultCircuitBreakerOptions.
+func NewCircuitBreaker(name string, opts CircuitBreakerOptions) *CircuitBreaker {
+	b := &CircuitBreaker{
+		name:        name,
+		opts:        opts.withDefaults(),
+		windowStart: time.Now(),
+	}
+	circuitStateGauge.WithLabelValues(name).Set(float64(CircuitClosed))
+	return b
+}
+
+func (r *CircuitBreaker) Name() string {
+	return r.name
+}
+
+func (r *CircuitBreaker) State() CircuitState {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.refresh(time.Now())
+	return r.state
+}
+
+// Allow returns an ErrDefCircuitOpen error if the call is rejected.
+// Otherwise, done must be called with the result of call.
+func (r *CircuitBreaker) Allow() (done func(failed bool), et ErrorType) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	r.refresh(now)
+
+	switch r.state {
+	case CircuitOpen:
+		circuitRejectedCounter.WithLabelValues(r.name).Inc()
+		return nil, ErrDefCircuitOpen.New(nil, r.name)
+	case CircuitHalfOpen:
+		if r.probes >= r.opts.HalfOpenRequests {
+			circuitRejectedCounter.WithLabelValues(r.name).Inc()
+			return nil, ErrDefCircuitOpen.New(nil, r.name)
+		}
+		r.probes++
+		return r.doneFunc(CircuitHalfOpen, r.openedAt), nil
+	}
+
+	return r.doneFunc(CircuitClosed, r.windowStart), nil
+}
+
+// doneFunc ignores results of calls allowed in a previous state or window.
+func (r *CircuitBreaker) doneFunc(state CircuitState, generation time.Time) func(failed bool) {
+	var once sync.Once
+	return func(failed bool) {
+		once.Do(func() {
+			r.lock.Lock()
+			defer r.lock.Unlock()
+			r.report(state, generation, failed, time.Now())
+		})
+	}
+}
+
+func (r *CircuitBreaker) report(state CircuitState, generation time.Time, failed bool, now time.Time) {
+	r.refresh(now)
+	if r.state != state {
+		return
+	}
+
+	switch state {
+	case CircuitClosed:
+		if !generation.Equal(r.windowStart) {
+			return
+		}
+		r.requests++
+		if failed {
+			r.failures++
+		}
+		if r.requests >= r.opts.MinRequests && float64(r.failures) >= r.opts.FailureRate*float64(r.requests) {
+			r.setState(CircuitOpen, now)
+		}
+	case CircuitHalfOpen:
+		if !generation.Equal(r.openedAt) {
+			return
+		}
+		if failed {
+			r.setState(CircuitOpen, now)
+			return
+		}
+		r.succeeded++
+		if r.succeeded >= r.opts.HalfOpenRequests {
+			r.setState(CircuitClosed, now)
+		}
+	}
+}
+
+// refresh moves open to half-open after OpenTimeout, and starts a new window.
+func (r *CircuitBreaker) refresh(now time.Time) {
+	if r.state == CircuitOpen && now.Sub(r.openedAt) >= r.opts.OpenTimeout {
+		r.setState(CircuitHalfOpen, now)
+	}
+	if r.state == CircuitClosed && now.Sub(r.windowStart) >= r.opts.Window {
+		r.windowStart, r.requests, r.failures = now, 0, 0
+	}
+}
+
+func (r *CircuitBreaker) setState(state CircuitState, now time.Time) {
+	if state == CircuitOpen {
+		r.openedAt = now
+		ModuleLogger("circuit_breaker").Warn("circuit is open", zap.String("circuit", r.name))
+	} else if state == CircuitClosed {
+		r.windowStart, r.requests, r.failures = now, 0, 0
+		ModuleLogger("circuit_breaker").Info("circuit is closed", zap.String("circuit", r.name))
+	}
+	r.probes, r.succeeded = 0, 0
+	r.state = state
+
+	circuitStateGauge.WithLabelValues(r.name).Set(float64(state))
+	circuitTransitionCounter.WithLabelValues(r.name, state.String()).Inc()
+}
+
+// CircuitBreakers keeps one CircuitBreaker per key, e.g. grpc method or http host.
+type CircuitBreakers struct {
+	opts     CircuitBreakerOptions
+	breakers sync.Map
+}
+
+// NewCircuitBreakers creates breakers of opts. Zero fields of opts are filled from DefaultCircuitBreakerOptions.
+func NewCircuitBreakers(opts CircuitBreakerOptions) *CircuitBreakers {
+	return &CircuitBreakers{opts: opts.withDefaults()}
+}
+
+// Get returns the breaker of name. Creates one if not.
+func (r *CircuitBreakers) Get(name string) *CircuitBreaker {
+	if b, ok := r.breakers.Load(name); ok {
+		return b.(*CircuitBreaker)
+	}
+	b, _ := r.breakers.LoadOrStore(name, NewCircuitBreaker(name, r.opts))
+	return b.(*CircuitBreaker)
+}
+
+// States returns states of all breakers.
+func (r *CircuitBreakers) States() map[string]CircuitState {
+	states := map[string]CircuitState{}
+	r.breakers.Range(func(k, v any) bool {
+		states[k.(string)] = v.(*CircuitBreaker).State()
+		return true
+	})
+	return states
+}
+
+// UnaryClientInterceptor breaks per method. Append it to GRPCDialOptions.UnaryInterceptors.
+func (r *CircuitBreakers) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		done, et := r.Get(method).Allow()
+		if et != nil {
+			return et
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		done(err != nil && r.opts.IsGRPCFailure(err))
+		return err
+	}
+}
+
+// StreamClientInterceptor breaks per method on creating streams.
+func (r *CircuitBreakers) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		done, et := r.Get(method).Allow()
+		if et != nil {
+			return nil, et
+		}
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		done(err != nil && r.opts.IsGRPCFailure(err))
+		return cs, err
+	}
+}
+
+// RoundTripper breaks outbound http calls per HTTPKey. next defaults to http.DefaultTransport.
+//
+//	client := &http.Client{Transport: breakers.RoundTripper(nil)}
+func (r *CircuitBreakers) RoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return circuitRoundTripper{breakers: r, next: next}
+}
+
+type circuitRoundTripper struct {
+	breakers *CircuitBreakers
+	next     http.RoundTripper
+}
+
+func (r circuitRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	done, et := r.breakers.Get(r.breakers.opts.HTTPKey(req)).Allow()
+	if et != nil {
+		return nil, et
+	}
+	resp, err := r.next.RoundTrip(req)
+	done(r.breakers.opts.IsHTTPFailure(resp, err))
+	return resp, err
+}
@@ -0,0 +1,109 @@
+package xf
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testBreakerOptions() CircuitBreakerOptions {
+	return CircuitBreakerOptions{
+		Window:           time.Minute,
+		MinRequests:      4,
+		FailureRate:      0.5,
+		OpenTimeout:      20 * time.Millisecond,
+		HalfOpenRequests: 2,
+	}
+}
+
+// call reports a call through b. Returns false if it's rejected.
+func call(b *CircuitBreaker, failed bool) bool {
+	done, et := b.Allow()
+	if et != nil {
+		return false
+	}
+	done(failed)
+	return true
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	b := NewCircuitBreaker("test-transitions", testBreakerOptions())
+
+	steps := []struct {
+		name     string
+		failed   bool
+		sleep    time.Duration
+		allowed  bool
+		expected CircuitState
+	}{
+		{"success", false, 0, true, CircuitClosed},
+		{"failure", true, 0, true, CircuitClosed},
+		{"success", false, 0, true, CircuitClosed},
+		{"failure reaches rate", true, 0, true, CircuitOpen},
+		{"rejected while open", false, 0, false, CircuitOpen},
+		{"probe fails", true, 30 * time.Millisecond, true, CircuitOpen},
+		{"rejected again", false, 0, false, CircuitOpen},
+		{"probe succeeds", false, 30 * time.Millisecond, true, CircuitHalfOpen},
+		{"all probes succeed", false, 0, true, CircuitClosed},
+		{"closed again", false, 0, true, CircuitClosed},
+	}
+
+	for i, s := range steps {
+		time.Sleep(s.sleep)
+		if allowed := call(b, s.failed); allowed != s.allowed {
+			t.Fatalf("step %d %s: allowed = %v", i, s.name, allowed)
+		}
+		if state := b.State(); state != s.expected {
+			t.Fatalf("step %d %s: state = %v, want %v", i, s.name, state, s.expected)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenLimitsProbes(t *testing.T) {
+	opts := testBreakerOptions()
+	opts.HalfOpenRequests = 1
+	b := NewCircuitBreaker("test-probes", opts)
+	for i := 0; i < 4; i++ {
+		call(b, true)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	done, et := b.Allow()
+	if et != nil {
+		t.Fatal(et)
+	}
+	if _, et := b.Allow(); et == nil {
+		t.Fatal("second probe allowed")
+	}
+	done(false)
+	if b.State() != CircuitClosed {
+		t.Fatalf("state = %v", b.State())
+	}
+}
+
+func TestCircuitBreakerZeroOptions(t *testing.T) {
+	breakers := NewCircuitBreakers(CircuitBreakerOptions{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := &http.Client{Transport: breakers.RoundTripper(nil)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	b := NewCircuitBreaker("test-zero", CircuitBreakerOptions{})
+	d := DefaultCircuitBreakerOptions()
+	for i := 0; i < d.MinRequests; i++ {
+		call(b, true)
+	}
+	if b.State() != CircuitOpen {
+		t.Fatalf("state = %v", b.State())
+	}
+	if !b.opts.IsGRPCFailure(errors.New("unknown")) {
+		t.Fatal("IsGRPCFailure is not defaulted")
+	}
+}
@@ -311,6 +311,9 @@ var #typeName#MongoIndexes = []mongo.IndexModel{
 }
 
 func #TypeName#MongoIndexes() []mongo.IndexModel {
+	if len(#typeName#TextSearchFields) > 0 {
+		return append(#typeName#MongoIndexes, xf.IndexText(#typeName#TextSearchFields))
+	}
 	return #typeName#MongoIndexes
 }
 
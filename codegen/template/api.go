@@ -115,6 +115,10 @@ func StartHttpServer() {
 
 	router.Use(gzip.Gzip(gzip.DefaultCompression))
 	router.Use(xf.GinLogger())
+	// 结构化访问日志（zap，module "access"），2xx可抽样：
+	//router.Use(xf.StructuredGinLogger(xf.DefaultAccessLogPolicy()))
+	router.Use(xf.GinMetricsMiddleware())
+	xf.RegisterMetricsHandler(router, "/metrics")
 	//corsConfig := cors.DefaultConfig()
 	//corsConfig.AllowOrigins = []string{"*"}
 	//router.Use(cors.New(corsConfig))
@@ -122,6 +126,13 @@ func StartHttpServer() {
 	// xf.GinMiddleware()必须在gzip后面
 	router.Use(xf.GinMiddleware())
 
+	// 错误响应默认为 {"error": {"code", "desc", "tid"}}。
+	// 需要 RFC 7807 application/problem+json 时，全局设置：
+	//xf.DefaultErrorResponseMode = xf.ErrorResponseModeProblem
+	//xf.ProblemTypeBaseURI = "https://api.example.com/errors/"
+	// 或者只对某个 route group 使用 group.Use(xf.ProblemDetailsMiddleware())
+	// problem type 列表见 xf.ErrorCatalogHandler
+
 	registerAPI()
 
 	xf.Infof("API server is listening at :%v", config.HTTPPort())
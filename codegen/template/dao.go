@@ -84,7 +84,9 @@ var mongoDB *mongo.Database
 
 func initMongo() {
 	// create mongoClient and mongoDBMapping
-	opts := options.Client().ApplyURI(config.MongodbHost())
+	opts := options.Client().ApplyURI(config.MongodbHost()).
+		SetMonitor(xf.MongoCommandMonitors(xf.MongoTracingMonitor(), xf.MongoMetricsMonitor(),
+			xf.MongoSlowQueryMonitor(xf.MongoSlowQueryOptions{ExplainClient: func() *mongo.Client { return mongoClient }})))
 	client, err := mongo.Connect(context.Background(), opts)
 	if err != nil {
 		xf.Panic(xf.ErrMongoConnectionError(err))
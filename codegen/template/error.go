@@ -4,7 +4,18 @@ const ERROR_GO = `package errs
 
 import "github.com/chris-sean/xf"
 
+// Declare each error code once. Duplicated codes panic on start.
+// Export the catalog with xf.ErrorCatalogJSON or xf.ErrorCatalogMarkdown.
+var (
+	ErrDefConflictError = xf.RegisterError(xf.ErrorDef{
+		Code:         "ConflictError",
+		Status:       409,
+		Message:      "Conflict: %v",
+		Translations: map[string]string{"zh": "数据冲突：%v"},
+	})
+)
+
 func ConflictError(err any) xf.ErrorType {
-	return xf.NewErrorType("ConflictError", 409, err)
+	return ErrDefConflictError.New(err)
 }
 `
@@ -17,7 +17,7 @@ type #TypeName# struct {
 
 func init() {
     obj := #TypeName#{}
-    #typeName#FilterFields, #typeName#SearchableFields, #typeName#ListFields, #typeName#DetailFields, #typeName#ModFields = xf.ParseXFTag(obj, "#tag#")
+    #typeName#FilterFields, #typeName#SearchableFields, #typeName#TextSearchFields, #typeName#ListFields, #typeName#DetailFields, #typeName#ModFields = xf.ParseXFTagWithTextSearch(obj, "#tag#")
     #typeName#Auth2JSONFields = xf.Auth2JSONMap(obj)
 }
 
@@ -27,6 +27,12 @@ func #TypeName#SearchableFields() []string {
 	return #typeName#SearchableFields
 }
 
+var #typeName#TextSearchFields []string
+
+func #TypeName#TextSearchFields() []string {
+	return #typeName#TextSearchFields
+}
+
 var #typeName#ListFields map[string]any
 
 func #TypeName#ListFields() map[string]any {
@@ -17,15 +17,16 @@ type #TypeName#Svc struct {
 func New#TypeName#Svc(ctx *xf.CTX) *#TypeName#Svc {
 	return &#TypeName#Svc{
 		CommonSvc: &xf.CommonSvc[#TypeName#, *#TypeName#]{
-			CTX:             ctx,
-			GenericDAO:      dao.New#TypeName#DAOGeneric,
-			ListFields:      model.#TypeName#ListFields(),
-			DetailFields:    model.#TypeName#DetailFields(),
-			FilterFields:    model.#TypeName#FilterFields(),
-			ModFields:       model.#TypeName#ModFields(),
-			KeywordToFields: model.#TypeName#SearchableFields(),
-			HardDeletion:    false,
-			AllowsModMany:   true,
+			CTX:              ctx,
+			GenericDAO:       dao.New#TypeName#DAOGeneric,
+			ListFields:       model.#TypeName#ListFields(),
+			DetailFields:     model.#TypeName#DetailFields(),
+			FilterFields:     model.#TypeName#FilterFields(),
+			ModFields:        model.#TypeName#ModFields(),
+			KeywordToFields:  model.#TypeName#SearchableFields(),
+			TextSearchFields: model.#TypeName#TextSearchFields(),
+			HardDeletion:     false,
+			AllowsModMany:    true,
 		},
 	}
 }
@@ -3,7 +3,9 @@ package xf
 import (
 	"context"
 	"sync"
+	"time"
 
+	"go.uber.org/zap"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -19,17 +21,158 @@ type CTX struct {
 	// PreferPanic is a preference to PoR and PoRErr.
 	PreferPanic bool
 
-	// See Set and Get.
-	kv map[string]interface{}
+	// CallTimeout is the default timeout of grpc calls made with CreateGRPCContext or FillGRPCContext.
+	// See CallTimeoutUnaryClientInterceptor.
+	CallTimeout time.Duration
+
+	// See Set, Get and CTXKey. Created on first write.
+	kv     map[any]any
+	kvLock sync.RWMutex
+
+	// principal is the verified caller. See SetPrincipal. Guarded by ctxLock.
+	principal *Principal
+
+	// ctx carries span, deadline and cancellation. See Context.
+	ctx     context.Context
+	ctxLock sync.RWMutex
+
+	// See AddLogFields.
+	logFields     []zap.Field
+	logFieldsLock sync.Mutex
+	// logger is cached by Logger, until log fields, principal or the global Logger change. Guarded by logFieldsLock.
+	logger          *zap.Logger
+	loggerBase      *zap.Logger
+	loggerPrincipal *Principal
+
+	// See RequestBody and ResponseBody.
+	requestBody  *requestBodyCapture
+	responseBody *responseBodyCapture
+}
+
+// CTX is a context.Context, delegating to Context(). So it can be passed to DAOs and grpc calls directly,
+// and they are canceled with the request. Value of ctxContextKey is CTX itself, see CTXFromContext.
+var _ context.Context = (*CTX)(nil)
+
+func (c *CTX) Deadline() (deadline time.Time, ok bool) {
+	return c.Context().Deadline()
+}
+
+func (c *CTX) Done() <-chan struct{} {
+	return c.Context().Done()
+}
+
+func (c *CTX) Err() error {
+	return c.Context().Err()
+}
+
+func (c *CTX) Value(key any) any {
+	if _, ok := key.(ctxContextKey); ok {
+		return c
+	}
+	return c.Context().Value(key)
+}
+
+// WithTimeout sets deadline of CTX. Call cancel when the job is done, which releases resources
+// and restores the previous context.Context, so that CTX is usable afterwards.
+func (c *CTX) WithTimeout(timeout time.Duration) (cancel context.CancelFunc) {
+	c.ctxLock.Lock()
+	parent := c.ctx
+	base := parent
+	if base == nil {
+		base = context.Background()
+	}
+	ctx, cancelCtx := context.WithTimeout(base, timeout)
+	c.ctx = ctx
+	c.ctxLock.Unlock()
+
+	return func() {
+		cancelCtx()
+		c.ctxLock.Lock()
+		// replaced meanwhile, e.g. detached by AutoRecoverAsync
+		if c.ctx == ctx {
+			c.ctx = parent
+		}
+		c.ctxLock.Unlock()
+	}
+}
+
+// Context returns context.Context of CTX, which carries span, deadline and cancellation of current request.
+// Returns context.Background() if not set.
+func (c *CTX) Context() context.Context {
+	if c == nil {
+		return context.Background()
+	}
+	c.ctxLock.RLock()
+	defer c.ctxLock.RUnlock()
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// SetContext replaces context.Context of CTX.
+func (c *CTX) SetContext(ctx context.Context) {
+	if cc, ok := ctx.(*CTX); ok && cc == c {
+		// would delegate to itself
+		return
+	}
+	c.ctxLock.Lock()
+	c.ctx = ctx
+	c.ctxLock.Unlock()
+}
+
+// detach drops deadline and cancellation of CTX, keeping values such as span. For CTX used after the request is done.
+func (c *CTX) detach() {
+	c.ctxLock.Lock()
+	if _, ok := c.ctx.(detachedContext); !ok && c.ctx != nil {
+		c.ctx = detachedContext{parent: c.ctx}
+	}
+	c.ctxLock.Unlock()
+}
+
+// detachedContext keeps values of parent, but not its deadline and cancellation. Same as context.WithoutCancel of Go 1.21.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) {
+	return
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (r detachedContext) Value(key any) any {
+	return r.parent.Value(key)
+}
+
+// Principal returns the verified caller. Returns nil if not authenticated.
+func (c *CTX) Principal() *Principal {
+	c.ctxLock.RLock()
+	defer c.ctxLock.RUnlock()
+	return c.principal
+}
+
+// SetPrincipal should be called only after the caller has been verified.
+func (c *CTX) SetPrincipal(p *Principal) {
+	c.ctxLock.Lock()
+	c.principal = p
+	c.ctxLock.Unlock()
 }
 
 // TraceID returns TraceID. Create one if not.
+// traceID set on creation is kept, it's written before CTX is shared.
 func (c *CTX) TraceID() string {
-	if c.traceID == "" {
-		c.traceIDOnce.Do(func() {
+	c.traceIDOnce.Do(func() {
+		if c.traceID == "" {
 			c.traceID = UUID12()
-		})
-	}
+		}
+	})
 	return c.traceID
 }
 
@@ -49,30 +192,15 @@ func (c *CTX) PoRErr(err error) error {
 	return err
 }
 
-// Get returns the value for the given key.
-// If the value does not exist it returns nil.
-func (c *CTX) Get(key string) interface{} {
-	v, ok := c.kv[key]
-	if !ok {
-		return nil
-	}
-	return v
-}
-
-// Set is used to store a new key/value pair exclusively for this context.
-func (c *CTX) Set(key string, value interface{}) {
-	c.kv[key] = value
-}
-
 // CreateGRPCContext create a context.Context with header "tid".
 func (c *CTX) CreateGRPCContext() context.Context {
-	ctx := context.Background()
-	return c.FillGRPCContext(ctx)
+	return c.FillGRPCContext(c.Context())
 }
 
 // FillGRPCContext append "tid" to context.Context .
 func (c *CTX) FillGRPCContext(context context.Context) context.Context {
-	return ContextByAppendingTraceID(context, c.traceID)
+	context = ContextWithCTX(context, c)
+	return ContextByAppendingTraceID(context, c.TraceID())
 }
 
 func ContextByAppendingTraceID(context context.Context, traceID string) context.Context {
@@ -115,7 +243,6 @@ func TraceIDFromMD(md metadata.MD) string {
 func NewContext() *CTX {
 	return &CTX{
 		PreferPanic: true,
-		kv:          map[string]interface{}{},
 	}
 }
 
@@ -129,5 +256,7 @@ func NewCTXWithGRPCContext(context context.Context) *CTX {
 	traceID := TraceIDFromIncoming(context)
 	c := NewContext()
 	c.traceID = traceID
+	c.principal = PrincipalFromContext(context)
+	c.SetContext(context)
 	return c
 }
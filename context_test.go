@@ -0,0 +1,129 @@
+package xf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestErrRequestCanceledNotLogged(t *testing.T) {
+	et := ErrRequestCanceled(context.Canceled)
+	if et.Extra() != &notWorthLogging {
+		t.Fatalf("extra = %v, want notWorthLogging", et.Extra())
+	}
+	if et.StatusCode() != 499 || !errors.Is(et, context.Canceled) {
+		t.Fatalf("unexpected %v %v", et.StatusCode(), et)
+	}
+}
+
+func TestContextErrorType(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    any
+		status int
+	}{
+		{"deadline", context.DeadlineExceeded, 504},
+		{"wrapped deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), 504},
+		{"canceled", context.Canceled, 499},
+		{"other", errors.New("other"), 0},
+		{"not error", "text", 0},
+		{"nil", nil, 0},
+		{"error type", ErrUnauthorized(context.Canceled), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			et := ContextErrorType(tt.err)
+			if tt.status == 0 {
+				if et != nil {
+					t.Fatalf("got %v, want nil", et)
+				}
+				return
+			}
+			if et == nil || et.StatusCode() != tt.status {
+				t.Fatalf("got %v, want status %d", et, tt.status)
+			}
+		})
+	}
+}
+
+func TestCTXWithTimeoutRestoresContext(t *testing.T) {
+	ctx := NewContext()
+	cancel := ctx.WithTimeout(time.Millisecond)
+	<-ctx.Done()
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		t.Fatalf("err = %v", ctx.Err())
+	}
+	cancel()
+	if ctx.Err() != nil {
+		t.Fatalf("err after cancel = %v", ctx.Err())
+	}
+}
+
+func TestAutoRecoverAsyncDetachesCTX(t *testing.T) {
+	type key struct{}
+	parent, cancelParent := context.WithCancel(context.WithValue(context.Background(), key{}, "v"))
+	ctx := NewContext()
+	ctx.SetContext(parent)
+
+	errs := make(chan error, 1)
+	started := make(chan struct{})
+	AutoRecoverAsync(ctx, func() {
+		<-started
+		if ctx.Value(key{}) != "v" {
+			errs <- errors.New("value lost")
+			return
+		}
+		errs <- ctx.Err()
+	})
+	// the request is done
+	cancelParent()
+	close(started)
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	if d := ctx.Clone(); d.Err() != nil {
+		t.Fatalf("clone of detached CTX: %v", d.Err())
+	}
+}
+
+func TestCTXTraceID(t *testing.T) {
+	if tid := NewCTXWithTraceID("abc").TraceID(); tid != "abc" {
+		t.Fatalf("tid = %q, want abc", tid)
+	}
+
+	c := NewContext()
+	tids := make(chan string, 8)
+	for i := 0; i < cap(tids); i++ {
+		go func() {
+			tids <- c.TraceID()
+		}()
+	}
+	first := <-tids
+	for i := 1; i < cap(tids); i++ {
+		if tid := <-tids; tid != first || tid == "" {
+			t.Fatalf("tid = %q, want %q", tid, first)
+		}
+	}
+}
+
+// Run with -race.
+func TestCTXConcurrentAccess(t *testing.T) {
+	c := NewContext()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.SetPrincipal(&Principal{ID: fmt.Sprint(i)})
+			c.SetContext(context.Background())
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_ = c.Principal()
+		_ = c.Context()
+		_ = c.Clone()
+	}
+	<-done
+}
@@ -0,0 +1,60 @@
+package xf
+
+import (
+	"go.uber.org/zap"
+)
+
+// Field names of contextual logs.
+const (
+	LogFieldTraceID   = "tid"
+	LogFieldPrincipal = "principal"
+	LogFieldTenant    = "tenant"
+	LogFieldRoute     = "route"
+)
+
+// Logger returns the global Logger with fields of CTX: tid, principal, tenant, route and fields added by AddLogFields.
+// Returns the global Logger if c is nil.
+func (c *CTX) Logger() *zap.Logger {
+	base := CurrentLogger()
+	if c == nil {
+		return base
+	}
+
+	traceID := c.TraceID()
+	p := c.Principal()
+
+	c.logFieldsLock.Lock()
+	defer c.logFieldsLock.Unlock()
+
+	if c.logger != nil && c.loggerBase == base && c.loggerPrincipal == p {
+		return c.logger
+	}
+
+	fields := make([]zap.Field, 0, 3+len(c.logFields))
+	fields = append(fields, zap.String(LogFieldTraceID, traceID))
+
+	if p != nil {
+		fields = append(fields, zap.String(LogFieldPrincipal, p.ID))
+		if p.Tenant != "" {
+			fields = append(fields, zap.String(LogFieldTenant, p.Tenant))
+		}
+	}
+
+	fields = append(fields, c.logFields...)
+
+	c.logger, c.loggerBase, c.loggerPrincipal = base.With(fields...), base, p
+	return c.logger
+}
+
+// SugaredLogger is the sugared version of Logger.
+func (c *CTX) SugaredLogger() *zap.SugaredLogger {
+	return c.Logger().Sugar()
+}
+
+// AddLogFields attaches fields to all logs of CTX. For fields of a few logs, use c.Logger().With(fields...).
+func (c *CTX) AddLogFields(fields ...zap.Field) {
+	c.logFieldsLock.Lock()
+	c.logFields = append(c.logFields, fields...)
+	c.logger = nil
+	c.logFieldsLock.Unlock()
+}
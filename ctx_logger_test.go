@@ -0,0 +1,56 @@
+package xf
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func observeLogs(t *testing.T) *observer.ObservedLogs {
+	old := globalLoggers.Load()
+	t.Cleanup(func() {
+		globalLoggers.Store(old)
+	})
+
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zap.New(core)
+	globalLoggers.Store(&globalLoggerSet{logger: logger, sugar: logger.Sugar()})
+	return logs
+}
+
+func TestCTXLogger(t *testing.T) {
+	logs := observeLogs(t)
+
+	c := NewCTXWithTraceID("tid-1")
+	logger := c.Logger()
+	if c.Logger() != logger {
+		t.Fatal("logger is not cached")
+	}
+
+	c.SetPrincipal(&Principal{ID: "u1", Tenant: "t1"})
+	c.AddLogFields(zap.String(LogFieldRoute, "/users/:id"))
+	if c.Logger() == logger {
+		t.Fatal("cached logger is not invalidated")
+	}
+	c.Logger().Info("hello")
+
+	fields := logs.All()[0].ContextMap()
+	expected := map[string]string{
+		LogFieldTraceID:   "tid-1",
+		LogFieldPrincipal: "u1",
+		LogFieldTenant:    "t1",
+		LogFieldRoute:     "/users/:id",
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Fatalf("%v = %v, want %v", k, fields[k], v)
+		}
+	}
+
+	logger = c.Logger()
+	observeLogs(t)
+	if c.Logger() == logger {
+		t.Fatal("logger is not rebuilt after reloading")
+	}
+}
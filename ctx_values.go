@@ -0,0 +1,135 @@
+package xf
+
+import (
+	"fmt"
+)
+
+// Get returns the value for the given key.
+// If the value does not exist it returns nil. Safe for concurrent use.
+func (c *CTX) Get(key string) interface{} {
+	v, _ := c.load(key)
+	return v
+}
+
+// Set is used to store a new key/value pair exclusively for this context. Safe for concurrent use.
+func (c *CTX) Set(key string, value interface{}) {
+	c.store(key, value)
+}
+
+// Delete removes the value for the given key.
+func (c *CTX) Delete(key string) {
+	c.kvLock.Lock()
+	delete(c.kv, key)
+	c.kvLock.Unlock()
+}
+
+func (c *CTX) load(key any) (any, bool) {
+	c.kvLock.RLock()
+	defer c.kvLock.RUnlock()
+	v, ok := c.kv[key]
+	return v, ok
+}
+
+func (c *CTX) store(key any, value any) {
+	c.kvLock.Lock()
+	defer c.kvLock.Unlock()
+	if c.kv == nil {
+		// CTX created by injectCTX or as a literal has no map yet.
+		c.kv = map[any]any{}
+	}
+	c.kv[key] = value
+}
+
+// CTXKey is a typed key of values on CTX. Keys are compared by identity, so values of different keys never collide,
+// even with the same name. Declare keys as package level variables.
+//
+//	var tenantConfigKey = xf.NewCTXKey[*TenantConfig]("tenantConfig")
+//
+//	tenantConfigKey.Set(ctx, cfg)
+//	cfg, ok := tenantConfigKey.Get(ctx)
+type CTXKey[T any] struct {
+	name string
+}
+
+func NewCTXKey[T any](name string) *CTXKey[T] {
+	return &CTXKey[T]{name: name}
+}
+
+func (k *CTXKey[T]) String() string {
+	return k.name
+}
+
+// Get returns the value of key. ok is false if it's not set.
+func (k *CTXKey[T]) Get(c *CTX) (value T, ok bool) {
+	v, ok := c.load(k)
+	if !ok {
+		return value, false
+	}
+	return v.(T), true
+}
+
+// GetOr returns the value of key, or def if it's not set.
+func (k *CTXKey[T]) GetOr(c *CTX, def T) T {
+	if v, ok := k.Get(c); ok {
+		return v
+	}
+	return def
+}
+
+// MustGet panics ErrServerInternalError if key is not set.
+func (k *CTXKey[T]) MustGet(c *CTX) T {
+	v, ok := k.Get(c)
+	if !ok {
+		panic(ErrServerInternalError(fmt.Errorf("%s is not set on CTX", k.name)))
+	}
+	return v
+}
+
+func (k *CTXKey[T]) Set(c *CTX, value T) {
+	c.store(k, value)
+}
+
+func (k *CTXKey[T]) Delete(c *CTX) {
+	c.kvLock.Lock()
+	delete(c.kv, k)
+	c.kvLock.Unlock()
+}
+
+// Clone returns a child CTX for another goroutine, with the same trace ID, principal, context.Context and log fields.
+// Values are copied shallowly, so that Set on either of them is invisible to the other.
+// The child is still canceled with the parent, see Detach for jobs outliving the request.
+// Request and response bodies are not carried.
+func (c *CTX) Clone() *CTX {
+	child := &CTX{
+		traceID:     c.TraceID(),
+		PreferPanic: c.PreferPanic,
+		CallTimeout: c.CallTimeout,
+	}
+	c.ctxLock.RLock()
+	child.principal = c.principal
+	child.ctx = c.ctx
+	c.ctxLock.RUnlock()
+
+	c.logFieldsLock.Lock()
+	child.logFields = append(child.logFields, c.logFields...)
+	c.logFieldsLock.Unlock()
+
+	c.kvLock.RLock()
+	if len(c.kv) > 0 {
+		child.kv = make(map[any]any, len(c.kv))
+		for k, v := range c.kv {
+			child.kv[k] = v
+		}
+	}
+	c.kvLock.RUnlock()
+
+	return child
+}
+
+// Detach returns a Clone which is not canceled with the parent, nor bound by its deadline.
+// Span and other values of context.Context are kept. Use it for jobs outliving the request.
+func (c *CTX) Detach() *CTX {
+	child := c.Clone()
+	child.detach()
+	return child
+}
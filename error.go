@@ -1,7 +1,14 @@
 package xf
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ErrorType interface {
@@ -21,8 +28,23 @@ type ErrorTypeEntity struct {
 	errStr      string
 	errorCode   interface{}
 	statusCode  int
+
+	// detail is a pointer, so that ErrorTypeEntity is still comparable by ==.
+	detail *errorDetail
+}
+
+type errorDetail struct {
+	// tmpl and args formatted errStr. Used for localization. See ErrorDef.
+	tmpl string
+	args []any
+
+	// stack is captured on creation. See ErrorStackDepth.
+	stack []uintptr
 }
 
+// ErrorStackDepth is the max number of frames captured by NewErrorType. 0 disables capturing.
+var ErrorStackDepth = 32
+
 // ErrorCode change it as you prefer.
 func (e ErrorTypeEntity) ErrorCode() interface{} {
 	return e.errorCode
@@ -56,20 +78,114 @@ func (e ErrorTypeEntity) OriginalError() any {
 	return e.originalErr
 }
 
+// Unwrap returns original error if it's an error, so that errors.Is and errors.As work through ErrorType.
+func (e ErrorTypeEntity) Unwrap() error {
+	err, _ := e.originalErr.(error)
+	return err
+}
+
+// Is returns true if target is an ErrorType with the same error code.
+func (e ErrorTypeEntity) Is(target error) bool {
+	var et ErrorType
+	if !errors.As(target, &et) {
+		return false
+	}
+	return sameErrorCode(e.errorCode, et.ErrorCode())
+}
+
+func sameErrorCode(a, b any) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) || !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// StackTrace returns the stack captured on creation. Returns "" if not captured.
+func (e ErrorTypeEntity) StackTrace() string {
+	if e.detail == nil || len(e.detail.stack) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	frames := runtime.CallersFrames(e.detail.stack)
+	skipping := true
+	for {
+		frame, more := frames.Next()
+		// skip constructors such as ErrXxx and ErrorDef.New
+		if skipping && isErrorConstructorFrame(frame) {
+			if !more {
+				break
+			}
+			continue
+		}
+		skipping = false
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+func isErrorConstructorFrame(frame runtime.Frame) bool {
+	return strings.HasPrefix(frame.Function, xfPackagePath+".Err") ||
+		strings.HasPrefix(frame.Function, xfPackagePath+".(*ErrorDef).")
+}
+
+// xfPackagePath is the import path of this package, e.g. github.com/chris-sean/xf
+var xfPackagePath = reflect.TypeOf(ErrorTypeEntity{}).PkgPath()
+
+// StackTracer is implemented by errors carrying a stack trace.
+type StackTracer interface {
+	StackTrace() string
+}
+
+// ErrorStackTrace returns stack trace of err, or of any error in its chain. Returns "" if not found.
+func ErrorStackTrace(err any) string {
+	e, ok := err.(error)
+	if !ok {
+		return ""
+	}
+	var st StackTracer
+	if errors.As(e, &st) {
+		return st.StackTrace()
+	}
+	return ""
+}
+
 func NewErrorType(errCode any, statusCode int, err any, a ...any) ErrorType {
+	switch e := err.(type) {
+	case error:
+		return newErrorType(errCode, statusCode, e, "%v", []any{e})
+	case string:
+		return newErrorType(errCode, statusCode, nil, e, a)
+	default:
+		return newErrorType(errCode, statusCode, nil, "%v", []any{err})
+	}
+}
+
+// newErrorType formats tmpl with args. originalErr is the cause for Unwrap.
+// Must be called by NewErrorType or ErrorDef.New, whose frames are skipped.
+func newErrorType(errCode any, statusCode int, originalErr error, tmpl string, args []any) ErrorTypeEntity {
+	d := &errorDetail{tmpl: tmpl, args: args}
 	et := ErrorTypeEntity{
 		errorCode:  errCode,
 		statusCode: statusCode,
+		errStr:     fmt.Sprintf(tmpl, args...),
+		detail:     d,
+	}
+	if originalErr != nil {
+		et.originalErr = originalErr
 	}
 
-	switch err.(type) {
-	case error:
-		et.originalErr = err
-		et.errStr = fmt.Sprintf("%v", err)
-	case string:
-		et.errStr = fmt.Sprintf(err.(string), a...)
-	default:
-		et.errStr = fmt.Sprintf("%v", err)
+	if ErrorStackDepth > 0 {
+		pcs := make([]uintptr, ErrorStackDepth)
+		// skip runtime.Callers, newErrorType and NewErrorType
+		n := runtime.Callers(3, pcs)
+		d.stack = pcs[:n]
 	}
 
 	return et
@@ -78,12 +194,15 @@ func NewErrorType(errCode any, statusCode int, err any, a ...any) ErrorType {
 var notWorthLogging byte
 var printErrAsInfo byte
 
-// TryConvertToErrorType returns an ErrorType if err is an ErrorType. returns nil if not.
+// TryConvertToErrorType returns an ErrorType if err is an ErrorType, or wraps one. returns nil if not.
 func TryConvertToErrorType(err interface{}) ErrorType {
 	et, ok := err.(ErrorType)
 	if ok {
 		return et
 	}
+	if e, ok := err.(error); ok && errors.As(e, &et) {
+		return et
+	}
 	return nil
 }
 
@@ -95,73 +214,189 @@ func ErrModPrintAsInfo(et ErrorTypeWriteable) {
 	et.SetExtra(&printErrAsInfo)
 }
 
+// Builtin error definitions. Projects should declare their own with RegisterError as well.
+var (
+	ErrDefAnyError              = RegisterError(ErrorDef{Code: "AnyError", Status: 500})
+	ErrDefGeneralError          = RegisterError(ErrorDef{Code: "GeneralError", Status: 500})
+	ErrDefServerInternalError   = RegisterError(ErrorDef{Code: "ServerInternalError", Status: 500})
+	ErrDefParamBindingError     = RegisterError(ErrorDef{Code: "ParamBindingError", Status: 400, Description: "Request parameters can't be bound to the expected type."})
+	ErrDefReadRequestBodyError  = RegisterError(ErrorDef{Code: "ReadRequestBodyError", Status: 500})
+	ErrDefUnmarshalJSONError    = RegisterError(ErrorDef{Code: "UnmarshalJSONError", Status: 400, Description: "Request body is not a valid JSON."})
+	ErrDefMarshalJSONError      = RegisterError(ErrorDef{Code: "MarshalJSONError", Status: 500})
+	ErrDefInvalidJWTPayload     = RegisterError(ErrorDef{Code: "InvalidJWTPayload", Status: 400})
+	ErrDefGRPCDialError         = RegisterError(ErrorDef{Code: "GRPCDialError", Status: 500, Message: "Can't dial to grpc server %v. error=%v"})
+	ErrDefMongoQueryError       = RegisterError(ErrorDef{Code: "MongoQueryError", Status: 500})
+	ErrDefMongoWriteError       = RegisterError(ErrorDef{Code: "MongoWriteError", Status: 500})
+	ErrDefMongoTransactionError = RegisterError(ErrorDef{Code: "MongoTransactionError", Status: 500})
+	ErrDefMongoConnectionError  = RegisterError(ErrorDef{Code: "MongoConnectionError", Status: 500})
+	ErrDefDBQueryError          = RegisterError(ErrorDef{Code: "DBQueryError", Status: 500, Message: "query=%v; err=%v"})
+	ErrDefInvalidParameters     = RegisterError(ErrorDef{
+		Code:         "InvalidParameters",
+		Status:       400,
+		Message:      "Invalid or missing parameter(s): '%v'",
+		Translations: map[string]string{"zh": "参数无效或缺失：'%v'"},
+	})
+	ErrDefNotFound = RegisterError(ErrorDef{
+		Code:         "NotFound",
+		Status:       400,
+		Message:      "Not found.",
+		Translations: map[string]string{"zh": "未找到。"},
+	})
+	ErrDefForbidden = RegisterError(ErrorDef{
+		Code:         "Forbidden",
+		Status:       403,
+		Message:      "Forbidden.",
+		Translations: map[string]string{"zh": "没有权限。"},
+	})
+	ErrDefUnauthorized = RegisterError(ErrorDef{
+		Code:         "Unauthorized",
+		Status:       401,
+		Message:      "Unauthorized.",
+		Translations: map[string]string{"zh": "未认证。"},
+	})
+	ErrDefShortUUIDConstraintError = RegisterError(ErrorDef{Code: "ShortUUIDConstraintError", Status: 500, Message: "length must be in [1, 32]"})
+	ErrDefDeadlineExceeded         = RegisterError(ErrorDef{
+		Code:         "DeadlineExceeded",
+		Status:       504,
+		Message:      "Deadline exceeded.",
+		Translations: map[string]string{"zh": "处理超时。"},
+		Description:  "The request or a downstream call didn't complete before the deadline of CTX.",
+	})
+	ErrDefRequestCanceled = RegisterError(ErrorDef{
+		Code:         "RequestCanceled",
+		Status:       499,
+		Message:      "Request canceled.",
+		Translations: map[string]string{"zh": "请求已取消。"},
+		Description:  "The client closed the request before it was done.",
+	})
+)
+
 func ErrAnyError(err any) ErrorType {
-	return NewErrorType("AnyError", 500, err)
+	return ErrDefAnyError.New(err)
 }
 
 func ErrGeneralError(err any) ErrorType {
-	return NewErrorType("GeneralError", 500, err)
+	return ErrDefGeneralError.New(err)
 }
 
 func ErrServerInternalError(err any) ErrorType {
-	return NewErrorType("ServerInternalError", 500, err)
+	return ErrDefServerInternalError.New(err)
 }
 
 func ErrParamBindingError(err any) ErrorType {
-	return NewErrorType("ParamBindingError", 400, err)
+	return ErrDefParamBindingError.New(err)
 }
 
 func ErrReadRequestBodyError(err any) ErrorType {
-	return NewErrorType("ReadRequestBodyError", 500, err)
+	return ErrDefReadRequestBodyError.New(err)
 }
 
 func ErrUnmarshalJSONError(err any) ErrorType {
-	return NewErrorType("UnmarshalJSONError", 400, err)
+	return ErrDefUnmarshalJSONError.New(err)
 }
 
 func ErrMarshalJSONError(err any) ErrorType {
-	return NewErrorType("MarshalJSONError", 500, err)
+	return ErrDefMarshalJSONError.New(err)
 }
 
 func ErrInvalidJWTPayload(err any) ErrorType {
-	return NewErrorType("InvalidJWTPayload", 400, err)
+	return ErrDefInvalidJWTPayload.New(err)
 }
 
 func ErrGRPCDialError(host string, err any) ErrorType {
-	return NewErrorType("GRPCDialError", 500, nil, fmt.Sprintf(`Can't dial to grpc server %v. error=%v`, host, err))
+	return ErrDefGRPCDialError.New(nil, host, err)
 }
 
 func ErrMongoQueryError(err any) ErrorType {
-	return NewErrorType("MongoQueryError", 500, err)
+	if et := ContextErrorType(err); et != nil {
+		return et
+	}
+	return ErrDefMongoQueryError.New(err)
 }
 
 func ErrMongoWriteError(err any) ErrorType {
-	return NewErrorType("MongoWriteError", 500, err)
+	if et := ContextErrorType(err); et != nil {
+		return et
+	}
+	return ErrDefMongoWriteError.New(err)
 }
 
 func ErrMongoTransactionError(err any) ErrorType {
-	return NewErrorType("MongoTransactionError", 500, err)
+	if et := ContextErrorType(err); et != nil {
+		return et
+	}
+	return ErrDefMongoTransactionError.New(err)
 }
 
 func ErrMongoConnectionError(err any) ErrorType {
-	return NewErrorType("MongoConnectionError", 500, err)
+	return ErrDefMongoConnectionError.New(err)
 }
 
 func ErrDBQueryError(query string, err any) ErrorType {
-	return NewErrorType("DBQueryError", 500, nil, "query=%v; err=%v", query, err)
+	if et := ContextErrorType(err); et != nil {
+		return et
+	}
+	return ErrDefDBQueryError.New(nil, query, err)
 }
 
 func ErrInvalidParameters(para string) ErrorType {
-	return NewErrorType("InvalidParameters", 400, nil, `Invalid or missing parameter(s): '%v'`, para)
+	return ErrDefInvalidParameters.New(nil, para)
 }
 
 func ErrNotFound(err any) ErrorType {
-	if err == nil {
-		err = "Not found."
+	if err == nil || err == "" {
+		return ErrDefNotFound.New(nil)
 	}
-	return NewErrorType("NotFound", 400, err)
+	return ErrDefNotFound.New(err)
 }
 
 func ErrForbidden(err any) ErrorType {
-	return NewErrorType("Forbidden", 403, err)
+	return ErrDefForbidden.New(err)
+}
+
+func ErrUnauthorized(err any) ErrorType {
+	return ErrDefUnauthorized.New(err)
+}
+
+func ErrDeadlineExceeded(err any) ErrorType {
+	return ErrDefDeadlineExceeded.New(err)
+}
+
+// ErrRequestCanceled is not logged, since the client has gone.
+func ErrRequestCanceled(err any) ErrorType {
+	// SetExtra has a pointer receiver
+	et := ErrDefRequestCanceled.New(err).(ErrorTypeEntity)
+	ErrModNoNeedToLog(&et)
+	return et
+}
+
+// errorTypeOf converts a returned error or a recovered panic to ErrorType.
+// Errors of context deadline or cancellation become ErrDeadlineExceeded or ErrRequestCanceled, others ErrAnyError.
+func errorTypeOf(err any) ErrorType {
+	if et := TryConvertToErrorType(err); et != nil {
+		return et
+	}
+	if et := ContextErrorType(err); et != nil {
+		return et
+	}
+	return ErrAnyError(err)
+}
+
+// ContextErrorType returns ErrDeadlineExceeded or ErrRequestCanceled if err is caused by deadline or cancellation
+// of context, e.g. of CTX. Returns nil if not, or err is already an ErrorType.
+func ContextErrorType(err any) ErrorType {
+	e, ok := err.(error)
+	if !ok || e == nil {
+		return nil
+	}
+	if _, ok := e.(ErrorType); ok {
+		return nil
+	}
+	if errors.Is(e, context.DeadlineExceeded) || mongo.IsTimeout(e) {
+		return ErrDeadlineExceeded(e)
+	}
+	if errors.Is(e, context.Canceled) {
+		return ErrRequestCanceled(e)
+	}
+	return nil
 }
@@ -0,0 +1,288 @@
+package xf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorDef declares an error code once, with http status, default message template and translations.
+type ErrorDef struct {
+	Code   string `json:"code"`
+	Status int    `json:"status"`
+	// Message is the default message template in fmt style.
+	Message string `json:"message"`
+	// Translations of Message keyed by language tag, e.g. "zh" or "zh-TW".
+	// Templates must use the same verbs as Message.
+	Translations map[string]string `json:"translations,omitempty"`
+	// Description is for documentation only.
+	Description string `json:"description,omitempty"`
+}
+
+// New creates an ErrorType of the definition.
+// If err is an error, Message is formatted with err followed by a, and err is kept for Unwrap.
+// A Message without verbs is used as it is, e.g. "Deadline exceeded.".
+// If err is nil, Message is formatted with a. Without a, a Message with verbs is not formatted,
+// and the error is "<nil>" as NewErrorType(code, status, nil).
+// Otherwise err is the same as NewErrorType, e.g. a string is a custom message, which is not localized.
+func (r *ErrorDef) New(err any, a ...any) ErrorType {
+	hasVerbs := strings.Contains(r.Message, "%")
+	switch e := err.(type) {
+	case nil:
+		if len(a) == 0 && hasVerbs {
+			return newErrorType(r.Code, r.Status, nil, "%v", []any{nil})
+		}
+		return newErrorType(r.Code, r.Status, nil, r.Message, a)
+	case error:
+		if !hasVerbs {
+			return newErrorType(r.Code, r.Status, e, r.Message, nil)
+		}
+		return newErrorType(r.Code, r.Status, e, r.Message, append([]any{e}, a...))
+	}
+	return NewErrorType(r.Code, r.Status, err, a...)
+}
+
+// ProblemType returns "type" of problem details responded for the definition. See ProblemTypeBaseURI.
+func (r *ErrorDef) ProblemType() string {
+	if ProblemTypeBaseURI == "" {
+		return "about:blank"
+	}
+	return ProblemTypeBaseURI + url.PathEscape(r.Code)
+}
+
+// Is returns true if err is an ErrorType with the same code.
+func (r *ErrorDef) Is(err error) bool {
+	et := TryConvertToErrorType(err)
+	return et != nil && et.ErrorCode() == r.Code
+}
+
+// Localize returns message of et in the language that best matches acceptLanguage.
+// Returns et.Error() if et is not created from Message, or no translation matches.
+func (r *ErrorDef) Localize(et ErrorType, acceptLanguage string) string {
+	e, ok := et.(ErrorTypeEntity)
+	if !ok || e.detail == nil || e.detail.tmpl != r.Message || len(r.Translations) == 0 {
+		return et.Error()
+	}
+
+	for _, lang := range parseAcceptLanguage(acceptLanguage) {
+		if tmpl, ok := r.translation(lang); ok {
+			return fmt.Sprintf(tmpl, e.detail.args...)
+		}
+	}
+
+	return et.Error()
+}
+
+func (r *ErrorDef) translation(lang string) (string, bool) {
+	if lang == "*" {
+		return "", false
+	}
+	for tag, tmpl := range r.Translations {
+		if strings.EqualFold(tag, lang) {
+			return tmpl, true
+		}
+	}
+	// zh-CN falls back to zh
+	if base, _, ok := strings.Cut(lang, "-"); ok {
+		return r.translation(base)
+	}
+	return "", false
+}
+
+// parseAcceptLanguage returns language tags sorted by quality.
+func parseAcceptLanguage(header string) []string {
+	type tag struct {
+		lang string
+		q    float64
+	}
+
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if lang == "" {
+			continue
+		}
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if f, err := strconv.ParseFloat(params[2:], 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			tags = append(tags, tag{lang: lang, q: q})
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	langs := make([]string, 0, len(tags))
+	for _, t := range tags {
+		langs = append(langs, t.lang)
+	}
+	return langs
+}
+
+var errorCatalog = map[string]*ErrorDef{}
+var errorCatalogLock sync.RWMutex
+
+// RegisterError registers an error definition. Panics if code has been registered.
+// Call it in package level var declarations, so collisions are found on start.
+func RegisterError(def ErrorDef) *ErrorDef {
+	if def.Code == "" {
+		panic(fmt.Errorf("RegisterError: empty error code"))
+	}
+	if def.Message == "" {
+		def.Message = "%v"
+	}
+
+	errorCatalogLock.Lock()
+	defer errorCatalogLock.Unlock()
+
+	if old, ok := errorCatalog[def.Code]; ok {
+		panic(fmt.Errorf("RegisterError: error code %v has been registered. status=%v; message=%v", def.Code, old.Status, old.Message))
+	}
+
+	d := &def
+	errorCatalog[def.Code] = d
+	return d
+}
+
+// LookupError returns the definition of code. Returns nil if not registered.
+func LookupError(code any) *ErrorDef {
+	s, ok := code.(string)
+	if !ok {
+		return nil
+	}
+	errorCatalogLock.RLock()
+	defer errorCatalogLock.RUnlock()
+	return errorCatalog[s]
+}
+
+// LocalizeError returns message of et in the language that best matches acceptLanguage.
+func LocalizeError(et ErrorType, acceptLanguage string) string {
+	if acceptLanguage == "" {
+		return et.Error()
+	}
+	def := LookupError(et.ErrorCode())
+	if def == nil {
+		return et.Error()
+	}
+	return def.Localize(et, acceptLanguage)
+}
+
+// ErrorCatalog returns all registered error definitions sorted by code.
+func ErrorCatalog() []ErrorDef {
+	errorCatalogLock.RLock()
+	defs := make([]ErrorDef, 0, len(errorCatalog))
+	for _, d := range errorCatalog {
+		defs = append(defs, *d)
+	}
+	errorCatalogLock.RUnlock()
+
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Code < defs[j].Code
+	})
+	return defs
+}
+
+// ErrorCatalogJSON exports error catalog as JSON.
+// "type" is the problem type responded in ErrorResponseModeProblem, if ProblemTypeBaseURI is set.
+func ErrorCatalogJSON() []byte {
+	type entry struct {
+		ErrorDef
+		Type string `json:"type,omitempty"`
+	}
+
+	defs := ErrorCatalog()
+	entries := make([]entry, 0, len(defs))
+	for i := range defs {
+		e := entry{ErrorDef: defs[i]}
+		if ProblemTypeBaseURI != "" {
+			e.Type = defs[i].ProblemType()
+		}
+		entries = append(entries, e)
+	}
+
+	bytes, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		panic(ErrMarshalJSONError(err))
+	}
+	return bytes
+}
+
+// ErrorCatalogMarkdown exports error catalog as a Markdown table.
+func ErrorCatalogMarkdown() string {
+	defs := ErrorCatalog()
+
+	// collect languages for columns
+	langSet := map[string]struct{}{}
+	for _, d := range defs {
+		for lang := range d.Translations {
+			langSet[lang] = struct{}{}
+		}
+	}
+	langs := make([]string, 0, len(langSet))
+	for lang := range langSet {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	// problem type column only makes sense with ProblemTypeBaseURI
+	withType := ProblemTypeBaseURI != ""
+
+	var b strings.Builder
+	b.WriteString("| Code | Status | Message |")
+	for _, lang := range langs {
+		b.WriteString(" " + lang + " |")
+	}
+	b.WriteString(" Description |")
+	if withType {
+		b.WriteString(" Type |")
+	}
+	b.WriteString("\n|---|---|---|")
+	for range langs {
+		b.WriteString("---|")
+	}
+	b.WriteString("---|")
+	if withType {
+		b.WriteString("---|")
+	}
+	b.WriteString("\n")
+
+	for i := range defs {
+		d := &defs[i]
+		fmt.Fprintf(&b, "| %s | %d | %s |", escapeMarkdownCell(d.Code), d.Status, escapeMarkdownCell(d.Message))
+		for _, lang := range langs {
+			b.WriteString(" " + escapeMarkdownCell(d.Translations[lang]) + " |")
+		}
+		b.WriteString(" " + escapeMarkdownCell(d.Description) + " |")
+		if withType {
+			b.WriteString(" " + escapeMarkdownCell(d.ProblemType()) + " |")
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+func escapeMarkdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// ErrorCatalogHandler responds error catalog. Query "format=md" for Markdown, JSON otherwise.
+func ErrorCatalogHandler(c *gin.Context) {
+	if c.Query("format") == "md" {
+		c.Data(200, "text/markdown; charset=utf-8", []byte(ErrorCatalogMarkdown()))
+		return
+	}
+	c.Data(200, "application/json; charset=utf-8", ErrorCatalogJSON())
+}
@@ -0,0 +1,62 @@
+package xf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorDefNew(t *testing.T) {
+	def := &ErrorDef{Code: "TestErrorDefNew", Status: 409, Message: "Conflict: %v"}
+	plain := &ErrorDef{Code: "TestErrorDefNewPlain", Status: 504, Message: "Deadline exceeded."}
+	cause := errors.New("duplicated key")
+
+	tests := []struct {
+		name     string
+		et       ErrorType
+		expected string
+	}{
+		{"nil without args", ErrAnyError(nil), "<nil>"},
+		{"template without args", def.New(nil), "<nil>"},
+		{"template with args", def.New(nil, "id"), "Conflict: id"},
+		{"plain message", plain.New(nil), "Deadline exceeded."},
+		{"error", def.New(cause), "Conflict: duplicated key"},
+		{"error of plain message", plain.New(cause), "Deadline exceeded."},
+		{"string", def.New("custom %v", 1), "custom 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.et.Error() != tt.expected {
+				t.Fatalf("got %q, want %q", tt.et.Error(), tt.expected)
+			}
+		})
+	}
+
+	if !errors.Is(def.New(cause), cause) {
+		t.Fatal("cause is not unwrapped")
+	}
+}
+
+func TestErrorDefLocalizeWithCause(t *testing.T) {
+	def := &ErrorDef{
+		Code:         "TestErrorDefLocalizeWithCause",
+		Status:       409,
+		Message:      "Conflict: %v",
+		Translations: map[string]string{"zh": "冲突：%v"},
+	}
+	cause := errors.New("duplicated key")
+	et := def.New(cause)
+
+	if msg := def.Localize(et, "zh-CN,en;q=0.5"); msg != "冲突：duplicated key" {
+		t.Fatalf("got %q", msg)
+	}
+	if msg := def.Localize(et, "en"); msg != "Conflict: duplicated key" {
+		t.Fatalf("got %q", msg)
+	}
+	if !errors.Is(et, cause) {
+		t.Fatal("cause is not unwrapped")
+	}
+
+	if msg := ErrDefDeadlineExceeded.Localize(ErrDeadlineExceeded(errors.New("context deadline exceeded")), "zh"); msg != "处理超时。" {
+		t.Fatalf("got %q", msg)
+	}
+}
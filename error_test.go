@@ -0,0 +1,26 @@
+package xf
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorTypeComparable(t *testing.T) {
+	a := ErrServerInternalError(errors.New("a"))
+	b := ErrServerInternalError(errors.New("a"))
+
+	var err error = a
+	if err != a {
+		t.Fatal("ErrorType is not equal to itself")
+	}
+	if a == b {
+		t.Fatal("different ErrorTypes are equal")
+	}
+	// same error code
+	if !errors.Is(err, a) || !errors.Is(err, b) {
+		t.Fatal("unexpected errors.Is")
+	}
+	if ErrorStackTrace(a) == "" {
+		t.Fatal("stack is not captured")
+	}
+}
@@ -10,27 +10,24 @@ import (
 	"net/http"
 	"reflect"
 	"strings"
-	"unsafe"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 //const TraceIDKey = "TID"
 
+// traceIDForGinCreateIfNil returns tid of CTX, which is resolved once by TraceIDSources. See injectCTX.
 func traceIDForGinCreateIfNil(c *gin.Context) (traceID string) {
 	if c == nil {
 		return "gin_Context_is_nil!"
 	}
-	traceID = c.GetHeader("X-Request-ID")
-	if traceID == "" {
-		traceID = UUID12()
-		c.Header("X-Request-ID", traceID)
-	}
-	return traceID
+	return getCTX(c).TraceID()
 }
 
 func traceIDFromGin(c *gin.Context) (traceID string) {
-	return c.GetHeader("X-Request-ID")
+	return traceIDForGinCreateIfNil(c)
 }
 
 // GinHelper provides some helper functions. Respond JSON only.
@@ -46,22 +43,58 @@ type GinHelper struct {
 
 func GinMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		injectCTX(c)
+		ctx := getCTX(c)
+		ctx.AddLogFields(zap.String(LogFieldRoute, c.FullPath()))
+		// for logs of respondError. See BodyCaptureMiddleware.
+		captureRequestBody(c, ctx, 0)
+		span := startGinSpan(c, ctx)
+		// runs after handlePanic, so that status of response is recorded.
+		defer endGinSpan(c, span)
+		// request context is canceled once the response is sent, but CTX might still be used by goroutines.
+		defer ctx.detach()
+		if DefaultRequestTimeout > 0 {
+			cancel := ctx.WithTimeout(DefaultRequestTimeout)
+			defer cancel()
+		}
 		defer handlePanic(c)
 		c.Next()
 	}
 }
 
+// DefaultRequestTimeout is the deadline of CTX of every request handled by GinMiddleware. 0 means no deadline,
+// CTX is still canceled if the client disconnects. See TimeoutMiddleware for deadlines of routes.
+var DefaultRequestTimeout time.Duration
+
+// TimeoutMiddleware sets deadline of CTX for routes, so that DAO operations and grpc calls fail with ErrDeadlineExceeded
+// when it's exceeded. It must be used after GinMiddleware. The deadline can be shortened only, not extended.
+//
+//	router.POST("/reports", xf.TimeoutMiddleware(30*time.Second), createReport)
+func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+		cancel := getCTX(c).WithTimeout(timeout)
+		defer cancel()
+		c.Next()
+	}
+}
+
 func injectCTX(c *gin.Context) *CTX {
 	if _, ok := c.Get("ctx"); ok {
 		return nil
 	}
 
 	ctx := &CTX{
-		traceID: UUID12(),
+		traceID: resolveTraceID(c.Request.Header.Get),
 	}
 	c.Set("ctx", ctx)
 
+	if TraceIDResponseHeader != "" {
+		c.Header(TraceIDResponseHeader, ctx.TraceID())
+	}
+
 	return ctx
 }
 
@@ -124,7 +157,7 @@ func (r *GinHelper) Bind(obj interface{}) bool {
 
 func respondJSON(c *gin.Context, status int, body interface{}) {
 	if c == nil {
-		Errorf("calling respondJSON(*gin.Context, status, body) with nil context")
+		ModuleLogger("gin").Error("calling respondJSON(*gin.Context, status, body) with nil context")
 		return
 	}
 	c.JSON(status, body)
@@ -156,11 +189,11 @@ func (r *GinHelper) RespondError(et ErrorType) {
 // respondError responds error in a response in JSON format.
 func respondError(gc *gin.Context, et ErrorType) {
 	if gc == nil {
-		Errorf("calling respondError(*gin.Context, et) with nil context")
+		ModuleLogger("gin").Error("calling respondError(*gin.Context, et) with nil context")
 		return
 	}
 	if et == nil {
-		Errorf("calling respondError(*gin.Context, et) with nil error")
+		getCTX(gc).Logger().Error("calling respondError(*gin.Context, et) with nil error")
 		gc.Abort()
 	}
 
@@ -174,7 +207,7 @@ func respondError(gc *gin.Context, et ErrorType) {
 		if ok {
 			// We are here only because recovery below panicked.
 			// If code panicked again. Process won't crash because http.serve() will recover.
-			Errorf("[%s] respondError panicked twice. et={type=%T; value=%v}", traceIDFromGin(gc), et, et)
+			getCTX(gc).Logger().Error("respondError panicked twice", zap.String("type", fmt.Sprintf("%T", et)), zap.String("value", fmt.Sprintf("%v", et)))
 			gc.Abort()
 			return
 		}
@@ -188,67 +221,74 @@ func respondError(gc *gin.Context, et ErrorType) {
 		}
 	}()
 
-	body := commonResponseBody()
 	payload := ErrorPayload{
 		Code: et.ErrorCode(),
-		Desc: et.Error(),
+		Desc: LocalizeError(et, gc.GetHeader("Accept-Language")),
 	}
 
 	payload.TID = traceIDForGinCreateIfNil(gc)
-	body[errorKey] = payload
+	gc.Set(errorCodeKey, payload.Code)
 
 	if gin.IsDebugging() || (et.Extra() != &notWorthLogging && et.StatusCode() >= 500) {
-		// get raw string of http request using reflect.
-		requestLog := requestAsText(gc.Request)
+		requestLog := requestAsText(gc.Request, getCTX(gc).RequestBody(), Redaction())
 
-		log := fmt.Sprintf("tid=%v; %scode=%v; error=%v; status=%v", payload.TID, requestLog, et.ErrorCode(), et.Error(), et.StatusCode())
+		fields := []zap.Field{
+			zap.Any("code", et.ErrorCode()),
+			zap.Int("status", et.StatusCode()),
+			zap.String("request", requestLog),
+		}
+
+		if et.StatusCode() >= 500 {
+			if stack := ErrorStackTrace(et); stack != "" {
+				fields = append(fields, zap.String("stack", stack))
+			}
+		}
 
+		logger := getCTX(gc).Logger()
 		if et.Extra() == &printErrAsInfo {
-			Info(log)
+			logger.Info(et.Error(), fields...)
 		} else {
-			Error(log)
+			logger.Error(et.Error(), fields...)
 		}
 	}
 
+	if errorResponseModeOf(gc) == ErrorResponseModeProblem {
+		respondProblem(gc, et.StatusCode(), NewProblemDetails(et, payload.Desc, gc.Request.URL.RequestURI(), payload.TID))
+		return
+	}
+
+	body := commonResponseBody()
+	body[errorKey] = payload
 	respondJSON(gc, et.StatusCode(), body)
 }
 
 var MaxLengthOfRequestDump = 4 * 1024
 
-func requestAsText(request *http.Request) (requestLog string) {
-	if request.ContentLength > 0 && request.Body != nil {
-		// Possible to fail with future go version.
-		v := reflect.ValueOf(request.Body).Elem()
-		v = v.FieldByName("src").Elem().Elem()
-		v = v.FieldByName("R").Elem().Elem()
-		lv := v.FieldByName("w") // get length of package
-		lv = reflect.NewAt(lv.Type(), unsafe.Pointer(lv.UnsafeAddr())).Elem()
-		length := lv.Interface().(int)
-		v = v.FieldByName("buf")
-		v = reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
-		buf, ok := v.Interface().([]byte)
-
-		if length > MaxLengthOfRequestDump {
-			length = MaxLengthOfRequestDump
+// requestAsText dumps request for logging. body is the captured request body, nil if not captured.
+// Sensitive headers and fields are masked by redactor.
+func requestAsText(request *http.Request, body *CapturedBody, redactor *Redactor) (requestLog string) {
+	headers := redactor.HeaderLines(request.Header)
+
+	var bodyLog string
+	if body != nil && len(body.Bytes) > 0 {
+		// redact before truncating, so that a sensitive value is not cut off from its key.
+		dump := redactor.Body(request.Header.Get("Content-Type"), decodedBody(request.Header, body.Bytes))
+		if len(dump) > MaxLengthOfRequestDump {
+			dump = dump[:MaxLengthOfRequestDump]
 		}
-
-		if ok {
-			requestLog = fmt.Sprintf("request:\n%s\n---EOR---\n", string(buf[:length]))
-		}
-	} else {
-		// assemble headers
-		headers := make([]string, 0, len(request.Header))
-		for k, vs := range request.Header {
-			for _, v := range vs {
-				headers = append(headers, k+": "+v)
-			}
+		bodyLog = string(dump)
+		if body.Truncated {
+			bodyLog += "...(truncated)"
 		}
-		requestLog = fmt.Sprintf(`request:
+		bodyLog += "\n"
+	}
+
+	requestLog = fmt.Sprintf(`request:
 %s %s
 %v
----EOR---
-`, request.Method, request.RequestURI, strings.Join(headers, "\n"))
-	}
+
+%s---EOR---
+`, request.Method, request.RequestURI, strings.Join(headers, "\n"), bodyLog)
 
 	return
 }
@@ -355,8 +395,11 @@ func handlePanic(c *gin.Context) {
 		if ok {
 			respondError(c, et)
 			c.Abort()
+		} else if et := ContextErrorType(err); et != nil {
+			respondError(c, et)
+			c.Abort()
 		} else {
-			respondError(c, ErrAnyError(et))
+			respondError(c, ErrAnyError(err))
 			c.Abort()
 			//Errorf("Gin has caught a panic. traceID=%s; error=%v", traceIDFromGin(c), err)
 			//c.AbortWithStatus(http.StatusInternalServerError)
@@ -364,10 +407,9 @@ func handlePanic(c *gin.Context) {
 	}
 }
 
-// CreateGRPCContext create a context.Context with header "tid".
+// CreateGRPCContext create a context.Context with header "tid", canceled with the request. See CTX.CreateGRPCContext.
 func (r *GinHelper) CreateGRPCContext() context.Context {
-	context := context.Background()
-	return getCTX(r.Context).FillGRPCContext(context)
+	return getCTX(r.Context).CreateGRPCContext()
 }
 
 var invalidJWTErr = errors.New("Invalid JWT.")
@@ -406,7 +448,14 @@ func OverwrittenByJWT(c *gin.Context, mapping map[string]string, json map[string
 	if len(mapping) == 0 || json == nil {
 		return
 	}
-	claims := GetJWTMapClaims(c)
+
+	var claims map[string]any
+	if p := getCTX(c).Principal(); p != nil && p.Claims != nil {
+		// verified by SetVerifiedClaims
+		claims = p.Claims
+	} else {
+		claims = GetJWTMapClaims(c)
+	}
 
 	if len(claims) == 0 {
 		return
@@ -49,6 +49,18 @@ type LoggerConfig struct {
 	// SkipPaths is an url path array which logs are not written.
 	// Optional.
 	SkipPaths []string
+
+	// Redactor masks sensitive headers and fields of the request dump in debug mode.
+	// Optional. Default value is Redaction().
+	Redactor *Redactor
+
+	// Structured logs requests through zap with module "access", instead of text to Output.
+	// Fields are tid, route, method, path, status, latency_ms, request_size, response_size, client_ip, principal, tenant and error_code.
+	Structured bool
+
+	// Policy decides which requests are logged. SkipPaths still applies.
+	// Optional. By default, all requests are logged in debug mode, and only non-2xx and slow requests in release mode.
+	Policy *AccessLogPolicy
 }
 
 // LogFormatter gives the signature of the formatter function passed to LoggerWithFormatter
@@ -226,6 +238,10 @@ func LoggerWithConfig(conf LoggerConfig) gin.HandlerFunc {
 
 	notlogged := conf.SkipPaths
 
+	policy := compileAccessLogPolicy(conf.Policy)
+
+	redactor := conf.Redactor
+
 	isTerm := true
 
 	if w, ok := out.(*os.File); !ok || os.Getenv("TERM") == "dumb" ||
@@ -252,15 +268,21 @@ func LoggerWithConfig(conf LoggerConfig) gin.HandlerFunc {
 		traceID := traceIDForGinCreateIfNil(c)
 
 		if gin.IsDebugging() {
-			requestText := requestAsText(c.Request)
-			Debugf("RCV %s", requestText)
+			r := redactor
+			if r == nil {
+				r = Redaction()
+			}
+			ctx := getCTX(c)
+			captureRequestBody(c, ctx, 0)
+			requestText := requestAsText(c.Request, ctx.RequestBody(), r)
+			ctx.Logger().Debug("RCV " + requestText)
 		}
 
 		// Process request
 		c.Next()
 
 		// Log only when path is not being skipped
-		if _, ok := skip[path]; !ok {
+		if _, ok := skip[path]; !ok && (policy == nil || !policy.skipPath(path)) {
 			param := LogFormatterParams{
 				Request: c.Request,
 				isTerm:  isTerm,
@@ -271,13 +293,18 @@ func LoggerWithConfig(conf LoggerConfig) gin.HandlerFunc {
 			param.TimeStamp = time.Now()
 			param.Latency = param.TimeStamp.Sub(start)
 
-			if !gin.IsDebugging() && param.Latency < SlowGinRequestLatencyThreshold {
+			param.StatusCode = c.Writer.Status()
+
+			if policy != nil {
+				if !policy.shouldLog(param.StatusCode, param.Latency) {
+					return
+				}
+			} else if !gin.IsDebugging() && param.Latency < SlowGinRequestLatencyThreshold && param.StatusCode >= 200 && param.StatusCode < 300 {
 				return
 			}
 
 			param.ClientIP = c.ClientIP()
 			param.Method = c.Request.Method
-			param.StatusCode = c.Writer.Status()
 			param.ErrorMessage = c.Errors.ByType(gin.ErrorTypePrivate).String()
 
 			param.BodySize = c.Writer.Size()
@@ -290,6 +317,11 @@ func LoggerWithConfig(conf LoggerConfig) gin.HandlerFunc {
 
 			param.traceID = traceID
 
+			if conf.Structured {
+				logAccess(c, traceID, param)
+				return
+			}
+
 			fmt.Fprint(out, formatter(param))
 		}
 	}
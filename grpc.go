@@ -2,11 +2,17 @@ package xf
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/keepalive"
+	"os"
 	"time"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
@@ -17,52 +23,191 @@ import (
 	"google.golang.org/grpc/metadata"
 )
 
+// DialGRPC dials host with DefaultGRPCDialOptions.
 func DialGRPC(host string, panicIfErrorOccurred bool) (*grpc.ClientConn, ErrorType) {
-	// Set up a connection to the server.
-	var err error
+	return DialGRPCWithOptions(host, DefaultGRPCDialOptions(), panicIfErrorOccurred)
+}
+
+// DefaultGRPCServiceConfig balances round-robin and retries UNAVAILABLE calls of all methods.
+// Round-robin requires a resolver returning multiple addresses, e.g. "dns:///service:9090".
+const DefaultGRPCServiceConfig = `{
+	"loadBalancingConfig": [{"round_robin": {}}],
+	"methodConfig": [{
+		"name": [{}],
+		"retryPolicy": {
+			"maxAttempts": 3,
+			"initialBackoff": "0.1s",
+			"maxBackoff": "1s",
+			"backoffMultiplier": 2,
+			"retryableStatusCodes": ["UNAVAILABLE"]
+		}
+	}]
+}`
+
+// GRPCDialOptions configures DialGRPCWithOptions. See DefaultGRPCDialOptions.
+type GRPCDialOptions struct {
+	// TLS is enabled if CAFile is set. mTLS is enabled if CertFile and KeyFile are set as well.
+	// Connection is insecure without CAFile.
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the name used to verify server certificate.
+	ServerName string
+
+	// ServiceConfig in JSON. "" disables service config.
+	ServiceConfig string
+
+	MinConnectTimeout time.Duration
+	// MaxBackoffDelay is the max interval of reconnecting.
+	MaxBackoffDelay time.Duration
+
+	KeepaliveTime    time.Duration
+	KeepaliveTimeout time.Duration
+
+	// DefaultCallTimeout applies to unary calls whose context has no deadline. See CTX.CallTimeout. 0 means no timeout.
+	DefaultCallTimeout time.Duration
+
+	// Interceptors appended after the builtin ones, e.g. ServiceAuthUnaryClientInterceptor.
+	UnaryInterceptors  []grpc.UnaryClientInterceptor
+	StreamInterceptors []grpc.StreamClientInterceptor
+
+	// DialOptions are passed to grpc.Dial at last.
+	DialOptions []grpc.DialOption
+}
+
+func DefaultGRPCDialOptions() GRPCDialOptions {
+	return GRPCDialOptions{
+		ServiceConfig:     DefaultGRPCServiceConfig,
+		MinConnectTimeout: 10 * time.Second, // 如果建立连接需要10秒，服务端或网络有问题。
+		MaxBackoffDelay:   3 * time.Second,  // 最多间隔MaxDelay秒重新尝试连接
+		KeepaliveTime:     10 * time.Second,
+		KeepaliveTimeout:  10 * time.Second,
+	}
+}
+
+// DialGRPCWithOptions dials host. Interceptors are chained in order:
+// tid from CTX in context, ErrorType conversion, default call timeout, tracing, zap logging, prometheus metrics, then opts.UnaryInterceptors/opts.StreamInterceptors.
+func DialGRPCWithOptions(host string, opts GRPCDialOptions, panicIfErrorOccurred bool) (*grpc.ClientConn, ErrorType) {
+	fail := func(err error) (*grpc.ClientConn, ErrorType) {
+		et := ErrGRPCDialError(host, err)
+		if panicIfErrorOccurred {
+			panic(et)
+		}
+		return nil, et
+	}
+
+	transportCredentials, err := opts.transportCredentials()
+	if err != nil {
+		return fail(err)
+	}
+
 	backoffCfg := backoff.DefaultConfig
-	backoffCfg.MaxDelay = 3 * time.Second // 最多间隔MaxDelay秒重新尝试连接
+	if opts.MaxBackoffDelay > 0 {
+		backoffCfg.MaxDelay = opts.MaxBackoffDelay
+	}
 
-	// Discussion
-	// With grpc.WithBlock() option set, grpc.Dial() will be blocked until connection be made.
-	// Without grpc.WithBlock() option set, if connection cannot be made yet, Dial() returns a ClientConn object and no error anyway.
-	// It seems Connection Backoff will handle retry connecting.
-	conn, err := grpc.Dial(
-		host,
-		grpc.WithInsecure(),
-		//grpc.WithBlock(),
+	unary := append([]grpc.UnaryClientInterceptor{
+		TraceIDUnaryClientInterceptor(),
+		ErrorTypeUnaryClientInterceptor(),
+		CallTimeoutUnaryClientInterceptor(opts.DefaultCallTimeout),
+		TracingUnaryClientInterceptor(),
+		grpc_zap.UnaryClientInterceptor(ModuleLogger("grpc.client"), GRPCClientZapLogOption()),
+		grpc_prometheus.UnaryClientInterceptor,
+	}, opts.UnaryInterceptors...)
+
+	stream := append([]grpc.StreamClientInterceptor{
+		TraceIDStreamClientInterceptor(),
+		ErrorTypeStreamClientInterceptor(),
+		TracingStreamClientInterceptor(),
+		grpc_zap.StreamClientInterceptor(ModuleLogger("grpc.client"), GRPCClientZapLogOption()),
+		grpc_prometheus.StreamClientInterceptor,
+	}, opts.StreamInterceptors...)
+
+	dialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(transportCredentials),
 		grpc.WithConnectParams(grpc.ConnectParams{
-			MinConnectTimeout: 10, // 如果建立连接需要10秒，服务端或网络有问题。
-			Backoff:           backoff.DefaultConfig,
+			MinConnectTimeout: opts.MinConnectTimeout,
+			Backoff:           backoffCfg,
 		}),
 		grpc.WithKeepaliveParams(keepalive.ClientParameters{
-			Time:                10 * time.Second,
-			Timeout:             10 * time.Second,
+			Time:                opts.KeepaliveTime,
+			Timeout:             opts.KeepaliveTimeout,
 			PermitWithoutStream: true,
 		}),
-		grpc.WithChainUnaryInterceptor(grpc_middleware.ChainUnaryClient(
-			grpc_zap.UnaryClientInterceptor(Logger, GRPCClientZapLogOption()),
-			grpc_prometheus.UnaryClientInterceptor,
-		)),
-		grpc.WithChainStreamInterceptor(grpc_middleware.ChainStreamClient(
-			grpc_zap.StreamClientInterceptor(Logger, GRPCClientZapLogOption()),
-			grpc_prometheus.StreamClientInterceptor,
-		)),
-	)
+		grpc.WithChainUnaryInterceptor(grpc_middleware.ChainUnaryClient(unary...)),
+		grpc.WithChainStreamInterceptor(grpc_middleware.ChainStreamClient(stream...)),
+	}
+
+	if opts.ServiceConfig != "" {
+		dialOptions = append(dialOptions, grpc.WithDefaultServiceConfig(opts.ServiceConfig))
+	}
+
+	dialOptions = append(dialOptions, opts.DialOptions...)
 
+	// Discussion
+	// With grpc.WithBlock() option set, grpc.Dial() will be blocked until connection be made.
+	// Without grpc.WithBlock() option set, if connection cannot be made yet, Dial() returns a ClientConn object and no error anyway.
+	// It seems Connection Backoff will handle retry connecting.
+	conn, err := grpc.Dial(host, dialOptions...)
 	if err != nil {
-		et := ErrGRPCDialError(host, err)
-		if panicIfErrorOccurred {
-			panic(et)
-		}
-		//Error("Can't dial to grpc server %v. error=%v", c.host, err)
-		return nil, et
+		return fail(err)
 	}
-	Infof("Create connection to GRPC Server %s", host)
+	ModuleLogger("grpc.client").Info("Create connection to GRPC Server", zap.String("host", host))
 
 	return conn, nil
 }
 
+func (r *GRPCDialOptions) transportCredentials() (credentials.TransportCredentials, error) {
+	if r.CAFile == "" {
+		return insecure.NewCredentials(), nil
+	}
+
+	ca, err := os.ReadFile(r.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("no certificate found in %s", r.CAFile)
+	}
+
+	cfg := &tls.Config{
+		RootCAs:    pool,
+		ServerName: r.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if r.CertFile != "" || r.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(cfg), nil
+}
+
+// CallTimeoutUnaryClientInterceptor sets deadline for calls whose context has no deadline.
+// Timeout is CTX.CallTimeout of the CTX in context (see CTX.CreateGRPCContext), or defaultTimeout.
+func CallTimeoutUnaryClientInterceptor(defaultTimeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			timeout := defaultTimeout
+			if c, ok := ctx.Value(ctxContextKey{}).(*CTX); ok && c.CallTimeout > 0 {
+				timeout = c.CallTimeout
+			}
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
 // GRPCClientZapLogOption almost the same compare to grpc_zap.DefaultMessageProducer. Additionally, log traceID.
 func GRPCClientZapLogOption() grpc_zap.Option {
 	return grpc_zap.WithMessageProducer(func(ctx context.Context, msg string, level zapcore.Level, code codes.Code, err error, duration zapcore.Field) {
@@ -0,0 +1,234 @@
+package xf
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// GRPCCRUDPackage prefixes service names of GRPCCRUD.
+var GRPCCRUDPackage = "xf.crud.v1"
+
+// GRPCCRUD exposes a CommonSvc over grpc, the same as API[T] over http.
+// All methods take and return google.protobuf.Struct:
+//
+//	Get(filter) returns the object
+//	Page(PageMeta) returns PageMeta with "data"
+//	List(PageMeta) returns {"data": [...]}
+//	Count(PageMeta) returns {"count": n}
+//	Add(object) returns {"id": id}
+//	Save(object) returns {}
+//	Set(updates) returns {"modified": n}
+//	Delete(filter) returns {}
+//
+// FilterFields and ModFields are enforced by CommonSvc. Outputs are masked by CommonSvc.UnmaskPermission.
+// Register it on a server created by NewGRPCServer, so that CTX and principal are ready.
+type GRPCCRUD[T any, P CommonModel[T]] struct {
+	// Name of service, e.g. "Device" for "xf.crud.v1.Device".
+	Name   string
+	GLASUD string // 默认开放的接口，同API.GLASUD
+
+	// Auth2JSON overwrites request fields by claims of principal. See OverwrittenByJWT.
+	Auth2JSON map[string]string
+
+	Svc func(c *CTX) *CommonSvc[T, P]
+}
+
+// ServiceName returns the full name of service, e.g. "xf.crud.v1.Device".
+func (r *GRPCCRUD[T, P]) ServiceName() string {
+	return GRPCCRUDPackage + "." + r.Name
+}
+
+// Register registers service to s.
+func (r *GRPCCRUD[T, P]) Register(s grpc.ServiceRegistrar) {
+	s.RegisterService(r.ServiceDesc(), r)
+}
+
+// ServiceDesc describes methods enabled by GLASUD.
+func (r *GRPCCRUD[T, P]) ServiceDesc() *grpc.ServiceDesc {
+	desc := &grpc.ServiceDesc{
+		ServiceName: r.ServiceName(),
+		// any server implements it
+		HandlerType: (*interface{})(nil),
+	}
+
+	for _, c := range r.GLASUD {
+		switch c {
+		case 'g':
+			desc.Methods = append(desc.Methods, r.method("Get", r.get))
+		case 'l':
+			desc.Methods = append(desc.Methods,
+				r.method("Page", r.getPage),
+				r.method("List", r.getList),
+				r.method("Count", r.count))
+		case 'a':
+			desc.Methods = append(desc.Methods, r.method("Add", r.add))
+		case 's':
+			desc.Methods = append(desc.Methods, r.method("Save", r.save))
+		case 'u':
+			desc.Methods = append(desc.Methods, r.method("Set", r.set))
+		case 'd':
+			desc.Methods = append(desc.Methods, r.method("Delete", r.del))
+		}
+	}
+
+	return desc
+}
+
+func (r *GRPCCRUD[T, P]) get(c *CTX, req map[string]any) any {
+	svc := r.Svc(c)
+	data := svc.MustGet(req)
+	svc.MaskOutput(data)
+	return data
+}
+
+func (r *GRPCCRUD[T, P]) getPage(c *CTX, req map[string]any) any {
+	page := r.mustGetPageReq(req)
+	svc := r.Svc(c)
+	data := svc.MustGetPage(page)
+	svc.MaskOutput(data)
+	return struct {
+		*PageMeta
+		Data []P `json:"data"`
+	}{page, data}
+}
+
+func (r *GRPCCRUD[T, P]) getList(c *CTX, req map[string]any) any {
+	svc := r.Svc(c)
+	data := svc.MustGetList(r.mustGetPageReq(req))
+	svc.MaskOutput(data)
+	return map[string]any{"data": data}
+}
+
+func (r *GRPCCRUD[T, P]) count(c *CTX, req map[string]any) any {
+	return map[string]any{"count": r.Svc(c).MustCount(r.mustGetPageReq(req))}
+}
+
+func (r *GRPCCRUD[T, P]) add(c *CTX, req map[string]any) any {
+	doc := r.mustGetObjReq(req)
+	r.Svc(c).MustAdd(doc)
+	return map[string]any{FieldID: doc.GetID()}
+}
+
+func (r *GRPCCRUD[T, P]) save(c *CTX, req map[string]any) any {
+	doc := r.mustGetObjReq(req)
+	r.Svc(c).MustSave(doc)
+	return nil
+}
+
+func (r *GRPCCRUD[T, P]) set(c *CTX, req map[string]any) any {
+	return map[string]any{"modified": r.Svc(c).MustUpdate(req)}
+}
+
+func (r *GRPCCRUD[T, P]) del(c *CTX, req map[string]any) any {
+	r.Svc(c).MustDelete(req)
+	return nil
+}
+
+func (r *GRPCCRUD[T, P]) mustGetObjReq(req map[string]any) P {
+	bytes, err := json.Marshal(req)
+	if err != nil {
+		panic(ErrMarshalJSONError(err))
+	}
+
+	// P is a pointer. json allocates it.
+	var doc P
+	if err = json.Unmarshal(bytes, &doc); err != nil {
+		panic(ErrParamBindingError(err))
+	}
+	return doc
+}
+
+// mustGetPageReq converts req to PageMeta. Match has been overwritten by claims.
+func (r *GRPCCRUD[T, P]) mustGetPageReq(req map[string]any) *PageMeta {
+	page := &PageMeta{}
+	MapToType(req, page)
+	if page.Match == nil {
+		page.Match = map[string]any{}
+	}
+	return page
+}
+
+func (r *GRPCCRUD[T, P]) method(name string, call func(c *CTX, req map[string]any) any) grpc.MethodDesc {
+	fullMethod := "/" + r.ServiceName() + "/" + name
+	isPageReq := name == "Page" || name == "List" || name == "Count"
+
+	handler := func(ctx context.Context, in any) (resp any, err error) {
+		// in case the server has no ErrorTypeUnaryServerInterceptor
+		defer func() {
+			if p := recover(); p != nil {
+				logRecovered(CTXFromContext(ctx), p)
+				resp, err = nil, grpcErrorOf(ctx, p)
+			}
+		}()
+
+		c := CTXFromContext(ctx)
+		req := in.(*structpb.Struct).AsMap()
+
+		if isPageReq {
+			match, _ := req["match"].(map[string]any)
+			if match == nil {
+				match = map[string]any{}
+			}
+			overwrittenByPrincipal(c.Principal(), r.Auth2JSON, match)
+			req["match"] = match
+		} else {
+			overwrittenByPrincipal(c.Principal(), r.Auth2JSON, req)
+		}
+
+		return mustConvertToStruct(call(c, req)), nil
+	}
+
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(structpb.Struct)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return handler(ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}
+			return interceptor(ctx, in, info, handler)
+		},
+	}
+}
+
+// overwrittenByPrincipal is OverwrittenByJWT for grpc.
+func overwrittenByPrincipal(p *Principal, mapping map[string]string, json map[string]any) {
+	if len(mapping) == 0 || p == nil || len(p.Claims) == 0 {
+		return
+	}
+
+	for js, jw := range mapping {
+		if w, ok := p.Claims[jw]; ok {
+			json[js] = w
+		}
+	}
+}
+
+// mustConvertToStruct converts v to google.protobuf.Struct through JSON, so that json tags are respected.
+func mustConvertToStruct(v any) *structpb.Struct {
+	if v == nil {
+		return &structpb.Struct{}
+	}
+
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		panic(ErrMarshalJSONError(err))
+	}
+
+	var m map[string]any
+	if err = json.Unmarshal(bytes, &m); err != nil {
+		panic(ErrUnmarshalJSONError(err))
+	}
+
+	s, err := structpb.NewStruct(m)
+	if err != nil {
+		panic(ErrMarshalJSONError(err))
+	}
+	return s
+}
@@ -0,0 +1,260 @@
+package xf
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCErrorDomain is the domain of errdetails.ErrorInfo carrying ErrorType.
+const GRPCErrorDomain = "xf"
+
+const (
+	grpcErrorMetaStatus   = "status"
+	grpcErrorMetaTID      = "tid"
+	grpcErrorMetaCodeKind = "code_kind"
+)
+
+var ErrDefGRPCCallError = RegisterError(ErrorDef{Code: "GRPCCallError", Status: 500, Description: "A grpc call failed without xf error details. Status depends on grpc code."})
+
+// HTTPStatusToGRPCCode maps http status to grpc code.
+func HTTPStatusToGRPCCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499: // client closed request
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+
+	if statusCode >= 400 && statusCode < 500 {
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
+
+// GRPCCodeToHTTPStatus maps grpc code to http status.
+func GRPCCodeToHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled:
+		return 499
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCStatus converts ErrorTypeEntity to grpc status, so that it can be returned by grpc handlers directly.
+// If the entity was rebuilt from a grpc status, the original status is returned.
+func (e ErrorTypeEntity) GRPCStatus() *status.Status {
+	if s, ok := e.originalErr.(interface{ GRPCStatus() *status.Status }); ok {
+		return s.GRPCStatus()
+	}
+	return ErrorTypeToGRPCStatus(e, "")
+}
+
+// ErrorTypeToGRPCStatus converts et to grpc status with error code, http status and traceID in errdetails.ErrorInfo.
+func ErrorTypeToGRPCStatus(et ErrorType, traceID string) *status.Status {
+	s := status.New(HTTPStatusToGRPCCode(et.StatusCode()), et.Error())
+
+	info := &errdetails.ErrorInfo{
+		Reason: fmt.Sprintf("%v", et.ErrorCode()),
+		Domain: GRPCErrorDomain,
+		Metadata: map[string]string{
+			grpcErrorMetaStatus: strconv.Itoa(et.StatusCode()),
+		},
+	}
+
+	if traceID != "" {
+		info.Metadata[grpcErrorMetaTID] = traceID
+	}
+
+	switch et.ErrorCode().(type) {
+	case int, int32, int64:
+		info.Metadata[grpcErrorMetaCodeKind] = "int"
+	}
+
+	if ds, err := s.WithDetails(info); err == nil {
+		s = ds
+	}
+
+	return s
+}
+
+// ErrorTypeFromGRPCError rebuilds ErrorType from a grpc error. Returns nil if err is nil.
+// Errors without xf details become ErrDefGRPCCallError with http status mapped from grpc code.
+func ErrorTypeFromGRPCError(err error) ErrorType {
+	if err == nil {
+		return nil
+	}
+
+	if et := TryConvertToErrorType(err); et != nil {
+		return et
+	}
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return ErrDefGRPCCallError.New(err)
+	}
+
+	for _, d := range s.Details() {
+		info, ok := d.(*errdetails.ErrorInfo)
+		if !ok || info.Domain != GRPCErrorDomain {
+			continue
+		}
+
+		statusCode, e := strconv.Atoi(info.Metadata[grpcErrorMetaStatus])
+		if e != nil {
+			statusCode = GRPCCodeToHTTPStatus(s.Code())
+		}
+
+		var code any = info.Reason
+		if info.Metadata[grpcErrorMetaCodeKind] == "int" {
+			if i, e := strconv.Atoi(info.Reason); e == nil {
+				code = i
+			}
+		}
+
+		return newErrorTypeFromGRPC(code, statusCode, s, err)
+	}
+
+	switch s.Code() {
+	case codes.DeadlineExceeded:
+		// deadline of the caller's context, see CTX.WithTimeout
+		return ErrDeadlineExceeded(err)
+	case codes.Canceled:
+		return ErrRequestCanceled(err)
+	}
+
+	return newErrorTypeFromGRPC(ErrDefGRPCCallError.Code, GRPCCodeToHTTPStatus(s.Code()), s, err)
+}
+
+func newErrorTypeFromGRPC(code any, statusCode int, s *status.Status, err error) ErrorType {
+	// keep message of remote service instead of "rpc error: code = ... desc = ..."
+	et := NewErrorType(code, statusCode, "%s", s.Message()).(ErrorTypeEntity)
+	et.originalErr = err
+	return et
+}
+
+// grpcErrorOf converts a returned error or a recovered panic to grpc error.
+func grpcErrorOf(ctx context.Context, err any) error {
+	if err == nil {
+		return nil
+	}
+
+	if e, ok := err.(error); ok {
+		if _, ok := status.FromError(e); ok && TryConvertToErrorType(e) == nil {
+			// already a grpc status
+			return e
+		}
+	}
+
+	return ErrorTypeToGRPCStatus(errorTypeOf(err), TraceIDFromIncoming(ctx)).Err()
+}
+
+// ErrorTypeUnaryServerInterceptor converts returned or panicked ErrorType to grpc status.
+// Panics are recovered and logged. Other panics become ErrAnyError.
+func ErrorTypeUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				logRecovered(CTXFromContext(ctx), p)
+				resp, err = nil, grpcErrorOf(ctx, p)
+			}
+		}()
+
+		resp, err = handler(ctx, req)
+		if err != nil {
+			err = grpcErrorOf(ctx, err)
+		}
+		return
+	}
+}
+
+// ErrorTypeStreamServerInterceptor is the stream version of ErrorTypeUnaryServerInterceptor.
+func ErrorTypeStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx := ss.Context()
+		defer func() {
+			if p := recover(); p != nil {
+				logRecovered(CTXFromContext(ctx), p)
+				err = grpcErrorOf(ctx, p)
+			}
+		}()
+
+		err = handler(srv, ss)
+		if err != nil {
+			err = grpcErrorOf(ctx, err)
+		}
+		return
+	}
+}
+
+// ErrorTypeUnaryClientInterceptor rebuilds ErrorType from grpc status returned by server.
+// The returned ErrorType still works with status.FromError and status.Code.
+func ErrorTypeUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err != nil {
+			return ErrorTypeFromGRPCError(err)
+		}
+		return nil
+	}
+}
+
+// ErrorTypeStreamClientInterceptor rebuilds ErrorType from grpc status when creating a stream.
+// Errors of RecvMsg and SendMsg can be converted by ErrorTypeFromGRPCError.
+func ErrorTypeStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, ErrorTypeFromGRPCError(err)
+		}
+		return cs, nil
+	}
+}
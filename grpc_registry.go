@@ -0,0 +1,289 @@
+package xf
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+)
+
+// GRPCService tells how to find a grpc service by its logical name.
+// Exactly one of Addresses, DNS and SRV should be set.
+type GRPCService struct {
+	Name string `json:"name"`
+	// Addresses are static "host:port".
+	Addresses []string `json:"addresses,omitempty"`
+	// DNS is "host:port" resolved by A/AAAA records.
+	DNS string `json:"dns,omitempty"`
+	// SRV is the full name of SRV records, e.g. "_grpc._tcp.device.svc.cluster.local".
+	SRV string `json:"srv,omitempty"`
+
+	// TLS. See GRPCDialOptions.
+	CAFile     string `json:"ca_file,omitempty"`
+	CertFile   string `json:"cert_file,omitempty"`
+	KeyFile    string `json:"key_file,omitempty"`
+	ServerName string `json:"server_name,omitempty"`
+}
+
+var ErrDefGRPCServiceNotFound = RegisterError(ErrorDef{Code: "GRPCServiceNotFound", Status: 500, Message: "grpc service %v is not registered"})
+
+// GRPCRegistry shares one grpc.ClientConn per service. It's safe for concurrent use.
+type GRPCRegistry struct {
+	// DialOptions are used to dial all services. TLS options are overridden by GRPCService.
+	DialOptions GRPCDialOptions
+	// RefreshInterval of re-resolving Addresses and SRV.
+	RefreshInterval time.Duration
+
+	lock     sync.RWMutex
+	services map[string]GRPCService
+	conns    map[string]*grpc.ClientConn
+}
+
+func NewGRPCRegistry() *GRPCRegistry {
+	return &GRPCRegistry{
+		DialOptions:     DefaultGRPCDialOptions(),
+		RefreshInterval: 30 * time.Second,
+		services:        map[string]GRPCService{},
+		conns:           map[string]*grpc.ClientConn{},
+	}
+}
+
+var grpcRegistry = NewGRPCRegistry()
+
+// GRPCServices returns the process-wide registry.
+func GRPCServices() *GRPCRegistry {
+	return grpcRegistry
+}
+
+// Register adds or replaces services.
+// Changes of Addresses and SRV take effect on next refresh. Changes of DNS and TLS take effect after Close.
+func (r *GRPCRegistry) Register(services ...GRPCService) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, s := range services {
+		if s.Name == "" {
+			panic(ErrInvalidParameters("name"))
+		}
+		r.services[s.Name] = s
+	}
+}
+
+// MustLoadFile registers services in a JSON array of GRPCService.
+func (r *GRPCRegistry) MustLoadFile(file string) {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		panic(ErrServerInternalError(fmt.Errorf("failed to read grpc services file %v. %v", file, err)))
+	}
+
+	var services []GRPCService
+	if err = json.Unmarshal(bytes, &services); err != nil {
+		panic(ErrUnmarshalJSONError(err))
+	}
+
+	r.Register(services...)
+}
+
+// MustConn returns the shared connection of service. Dials on first call.
+func (r *GRPCRegistry) MustConn(name string) *grpc.ClientConn {
+	r.lock.RLock()
+	conn, ok := r.conns[name]
+	r.lock.RUnlock()
+	if ok {
+		return conn
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if conn, ok = r.conns[name]; ok {
+		return conn
+	}
+
+	s, ok := r.services[name]
+	if !ok {
+		panic(ErrDefGRPCServiceNotFound.New(nil, name))
+	}
+
+	opts := r.DialOptions
+	opts.CAFile, opts.CertFile, opts.KeyFile, opts.ServerName = s.CAFile, s.CertFile, s.KeyFile, s.ServerName
+
+	var target string
+	if s.DNS != "" {
+		target = "dns:///" + s.DNS
+	} else {
+		target = grpcRegistryScheme + ":///" + name
+		opts.DialOptions = append(append([]grpc.DialOption(nil), opts.DialOptions...),
+			grpc.WithResolvers(&grpcRegistryResolverBuilder{registry: r}))
+	}
+
+	conn, _ = DialGRPCWithOptions(target, opts, true)
+	r.conns[name] = conn
+	return conn
+}
+
+// States returns connectivity state of dialed services.
+func (r *GRPCRegistry) States() map[string]connectivity.State {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	states := make(map[string]connectivity.State, len(r.conns))
+	for name, conn := range r.conns {
+		states[name] = conn.GetState()
+	}
+	return states
+}
+
+// Healthy returns false if any dialed service is in TRANSIENT_FAILURE or SHUTDOWN.
+func (r *GRPCRegistry) Healthy() bool {
+	for _, state := range r.States() {
+		if state == connectivity.TransientFailure || state == connectivity.Shutdown {
+			return false
+		}
+	}
+	return true
+}
+
+// HealthHandler responds states of dialed services. Status is 503 if not Healthy.
+func (r *GRPCRegistry) HealthHandler(c *gin.Context) {
+	states := map[string]string{}
+	for name, state := range r.States() {
+		states[name] = state.String()
+	}
+	status := 200
+	if !r.Healthy() {
+		status = 503
+	}
+	c.JSON(status, gin.H{"grpc": states})
+}
+
+// Close closes all connections. Services are kept, and will be dialed again by MustConn.
+func (r *GRPCRegistry) Close() {
+	r.lock.Lock()
+	conns := r.conns
+	r.conns = map[string]*grpc.ClientConn{}
+	r.lock.Unlock()
+
+	for name, conn := range conns {
+		if err := conn.Close(); err != nil {
+			Warnf("failed to close grpc connection to %v. %v", name, err)
+		}
+	}
+}
+
+// addresses resolves addresses of service.
+func (r *GRPCRegistry) addresses(name string) ([]resolver.Address, error) {
+	r.lock.RLock()
+	s, ok := r.services[name]
+	r.lock.RUnlock()
+	if !ok {
+		return nil, ErrDefGRPCServiceNotFound.New(nil, name)
+	}
+
+	hosts := s.Addresses
+	if s.SRV != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", s.SRV)
+		if err != nil {
+			return nil, err
+		}
+		hosts = make([]string, 0, len(records))
+		for _, rec := range records {
+			hosts = append(hosts, net.JoinHostPort(strings.TrimSuffix(rec.Target, "."), strconv.Itoa(int(rec.Port))))
+		}
+	}
+
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no address of grpc service %v", name)
+	}
+
+	// stable order prevents needless updates of balancer
+	sort.Strings(hosts)
+	addrs := make([]resolver.Address, 0, len(hosts))
+	for _, h := range hosts {
+		addrs = append(addrs, resolver.Address{Addr: h})
+	}
+	return addrs, nil
+}
+
+const grpcRegistryScheme = "xf-registry"
+
+type grpcRegistryResolverBuilder struct {
+	registry *GRPCRegistry
+}
+
+func (b *grpcRegistryResolverBuilder) Scheme() string {
+	return grpcRegistryScheme
+}
+
+func (b *grpcRegistryResolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	r := &grpcRegistryResolver{
+		registry: b.registry,
+		name:     strings.TrimPrefix(target.URL.Path, "/"),
+		cc:       cc,
+		now:      make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go r.watch()
+	return r, nil
+}
+
+type grpcRegistryResolver struct {
+	registry *GRPCRegistry
+	name     string
+	cc       resolver.ClientConn
+	now      chan struct{}
+	done     chan struct{}
+}
+
+func (r *grpcRegistryResolver) watch() {
+	interval := r.registry.RefreshInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.resolve()
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		case <-r.now:
+		}
+	}
+}
+
+func (r *grpcRegistryResolver) resolve() {
+	addrs, err := r.registry.addresses(r.name)
+	if err != nil {
+		Warnf("failed to resolve grpc service %v. %v", r.name, err)
+		r.cc.ReportError(err)
+		return
+	}
+	if err = r.cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		Debugf("grpc service %v: %v", r.name, err)
+	}
+}
+
+func (r *grpcRegistryResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.now <- struct{}{}:
+	default:
+	}
+}
+
+func (r *grpcRegistryResolver) Close() {
+	close(r.done)
+}
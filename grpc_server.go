@@ -0,0 +1,264 @@
+package xf
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+)
+
+// GRPCServerOptions configures NewGRPCServer. See DefaultGRPCServerOptions.
+type GRPCServerOptions struct {
+	// Address to listen, e.g. ":9090".
+	Address string
+
+	// Keepalive parameters sent to clients.
+	KeepaliveTime         time.Duration
+	KeepaliveTimeout      time.Duration
+	MaxConnectionIdle     time.Duration
+	MaxConnectionAge      time.Duration
+	MaxConnectionAgeGrace time.Duration
+
+	// Keepalive enforcement. Clients pinging more often than MinPingInterval are disconnected.
+	MinPingInterval     time.Duration
+	PermitWithoutStream bool
+
+	DisableHealth     bool
+	DisableReflection bool
+
+	// GracefulStopTimeout is the max time to wait for pending RPCs on GracefulStop. Then the server is stopped forcibly.
+	GracefulStopTimeout time.Duration
+
+	// Interceptors appended after the builtin ones, e.g. ServiceAuthenticator.UnaryServerInterceptor().
+	UnaryInterceptors  []grpc.UnaryServerInterceptor
+	StreamInterceptors []grpc.StreamServerInterceptor
+
+	// ServerOptions are passed to grpc.NewServer, e.g. grpc.Creds.
+	// Interceptors set by grpc.UnaryInterceptor/grpc.StreamInterceptor run before the builtin ones,
+	// and those of grpc.ChainUnaryInterceptor/grpc.ChainStreamInterceptor after opts.UnaryInterceptors/opts.StreamInterceptors.
+	ServerOptions []grpc.ServerOption
+}
+
+func DefaultGRPCServerOptions() GRPCServerOptions {
+	return GRPCServerOptions{
+		Address:               ":9090",
+		KeepaliveTime:         2 * time.Hour,
+		KeepaliveTimeout:      20 * time.Second,
+		MaxConnectionIdle:     15 * time.Minute,
+		MaxConnectionAgeGrace: 10 * time.Second,
+		// DialGRPC pings every 10 seconds.
+		MinPingInterval:     5 * time.Second,
+		PermitWithoutStream: true,
+		GracefulStopTimeout: 30 * time.Second,
+	}
+}
+
+// GRPCServer is a grpc.Server with standard interceptors, health and reflection services.
+type GRPCServer struct {
+	*grpc.Server
+
+	// Health is nil if DisableHealth.
+	Health *health.Server
+
+	opts GRPCServerOptions
+}
+
+// NewGRPCServer creates a grpc server. Interceptors are chained in order:
+// prometheus metrics, tracing, CTX from incoming metadata, zap logging with tid, recovery to ErrorType status,
+// then opts.UnaryInterceptors/opts.StreamInterceptors.
+// Register services before calling Serve.
+func NewGRPCServer(opts GRPCServerOptions) *GRPCServer {
+	unary := append([]grpc.UnaryServerInterceptor{
+		grpc_prometheus.UnaryServerInterceptor,
+		TracingUnaryServerInterceptor(),
+		CTXUnaryServerInterceptor(),
+		grpc_zap.UnaryServerInterceptor(ModuleLogger("grpc.server"), GRPCServerZapLogOption()),
+		ErrorTypeUnaryServerInterceptor(),
+	}, opts.UnaryInterceptors...)
+
+	stream := append([]grpc.StreamServerInterceptor{
+		grpc_prometheus.StreamServerInterceptor,
+		TracingStreamServerInterceptor(),
+		CTXStreamServerInterceptor(),
+		grpc_zap.StreamServerInterceptor(ModuleLogger("grpc.server"), GRPCServerZapLogOption()),
+		ErrorTypeStreamServerInterceptor(),
+	}, opts.StreamInterceptors...)
+
+	serverOptions := append([]grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     opts.MaxConnectionIdle,
+			MaxConnectionAge:      opts.MaxConnectionAge,
+			MaxConnectionAgeGrace: opts.MaxConnectionAgeGrace,
+			Time:                  opts.KeepaliveTime,
+			Timeout:               opts.KeepaliveTimeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             opts.MinPingInterval,
+			PermitWithoutStream: opts.PermitWithoutStream,
+		}),
+		// chained, so that interceptors of opts.ServerOptions don't conflict with them.
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}, opts.ServerOptions...)
+
+	s := &GRPCServer{
+		Server: grpc.NewServer(serverOptions...),
+		opts:   opts,
+	}
+
+	if !opts.DisableHealth {
+		s.Health = health.NewServer()
+		grpc_health_v1.RegisterHealthServer(s.Server, s.Health)
+	}
+
+	if !opts.DisableReflection {
+		reflection.Register(s.Server)
+	}
+
+	return s
+}
+
+// SetServingStatus sets health status of service. "" refers to the whole server.
+func (r *GRPCServer) SetServingStatus(service string, serving bool) {
+	if r.Health == nil {
+		return
+	}
+	status := grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = grpc_health_v1.HealthCheckResponse_SERVING
+	}
+	r.Health.SetServingStatus(service, status)
+}
+
+// Serve accepts connections on lis. Blocks until stopped.
+func (r *GRPCServer) Serve(lis net.Listener) error {
+	// metrics of registered services are initialized to 0
+	grpc_prometheus.Register(r.Server)
+	Infof("GRPC server is listening at %v", lis.Addr())
+	return r.Server.Serve(lis)
+}
+
+// MustListenAndServe listens on Address and serves until SIGINT or SIGTERM, then stops gracefully.
+func (r *GRPCServer) MustListenAndServe() {
+	lis, err := net.Listen("tcp", r.opts.Address)
+	if err != nil {
+		Panic(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Serve(lis)
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	select {
+	case err = <-done:
+		if err != nil {
+			Panic(err)
+		}
+	case s := <-sig:
+		Infof("GRPC server received signal %v", s)
+		r.GracefulStop()
+	}
+}
+
+// GracefulStop marks the server NOT_SERVING, then waits pending RPCs for at most GracefulStopTimeout.
+func (r *GRPCServer) GracefulStop() {
+	if r.Health != nil {
+		r.Health.Shutdown()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		r.Server.GracefulStop()
+		close(stopped)
+	}()
+
+	if r.opts.GracefulStopTimeout <= 0 {
+		<-stopped
+		return
+	}
+
+	select {
+	case <-stopped:
+		Info("GRPC server stopped gracefully")
+	case <-time.After(r.opts.GracefulStopTimeout):
+		Warnf("GRPC server is stopped forcibly after %v", r.opts.GracefulStopTimeout)
+		r.Server.Stop()
+	}
+}
+
+type ctxContextKey struct{}
+
+// ContextWithCTX returns a context.Context carrying c.
+func ContextWithCTX(ctx context.Context, c *CTX) context.Context {
+	return context.WithValue(ctx, ctxContextKey{}, c)
+}
+
+// CTXFromContext returns CTX set by CTXUnaryServerInterceptor or ContextWithCTX.
+// Creates one from incoming metadata if not found.
+func CTXFromContext(ctx context.Context) *CTX {
+	c, ok := ctx.Value(ctxContextKey{}).(*CTX)
+	if !ok {
+		return NewCTXWithGRPCContext(ctx)
+	}
+	if c.Principal() == nil {
+		// authenticated by an interceptor after CTX was created
+		if p := PrincipalFromContext(ctx); p != nil {
+			c.SetPrincipal(p)
+		}
+	}
+	return c
+}
+
+// ensureIncomingTraceID resolves tid by TraceIDSources, and sets it to incoming metadata, so that logs and CTX share the same tid.
+func ensureIncomingTraceID(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	traceID := resolveTraceIDFromMD(md)
+	if TraceIDFromMD(md) == traceID {
+		return ctx
+	}
+	md = md.Copy()
+	md.Set("tid", traceID)
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+// CTXUnaryServerInterceptor creates CTX from incoming metadata. Get it by CTXFromContext in handlers.
+func CTXUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = ensureIncomingTraceID(ctx)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String(AttrTraceID, TraceIDFromIncoming(ctx)))
+		c := NewCTXWithGRPCContext(ctx)
+		c.AddLogFields(zap.String(LogFieldRoute, info.FullMethod))
+		return handler(ContextWithCTX(ctx, c), req)
+	}
+}
+
+// CTXStreamServerInterceptor is the stream version of CTXUnaryServerInterceptor.
+func CTXStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ensureIncomingTraceID(ss.Context())
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String(AttrTraceID, TraceIDFromIncoming(ctx)))
+		c := NewCTXWithGRPCContext(ctx)
+		c.AddLogFields(zap.String(LogFieldRoute, info.FullMethod))
+		ctx = ContextWithCTX(ctx, c)
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
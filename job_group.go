@@ -0,0 +1,132 @@
+package xf
+
+import (
+	"context"
+	"sync"
+)
+
+// JobGroup runs jobs concurrently, at most limit of them at a time. Each job gets a child CTX (see CTX.Clone),
+// which carries tid of the parent and is canceled when the parent is done or any job fails.
+// Panics are recovered, logged and converted to ErrorType. Wait returns the first error.
+//
+//	g := xf.NewJobGroup(ctx, 4)
+//	g.Go(func(ctx *xf.CTX) error { user = userDAO(ctx).MustGet(id); return nil })
+//	g.Go(func(ctx *xf.CTX) error { orders, err = orderClient.List(ctx.CreateGRPCContext(), req); return err })
+//	if err := g.Wait(); err != nil {
+//		panic(err)
+//	}
+type JobGroup struct {
+	ctx    *CTX
+	done   context.Context
+	cancel context.CancelFunc
+	// sem is nil if concurrency is unbounded.
+	sem chan struct{}
+
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     ErrorType
+}
+
+// NewJobGroup creates a JobGroup of parent. limit <= 0 means unbounded. A new CTX is created if parent is nil.
+func NewJobGroup(parent *CTX, limit int) *JobGroup {
+	if parent == nil {
+		parent = NewContext()
+	}
+	done, cancel := context.WithCancel(parent.Context())
+	g := &JobGroup{ctx: parent, done: done, cancel: cancel}
+	if limit > 0 {
+		g.sem = make(chan struct{}, limit)
+	}
+	return g
+}
+
+// Go runs job in a new goroutine. It blocks until a slot is available.
+// job is skipped if the group is canceled already, by a failed job or the parent.
+func (g *JobGroup) Go(job func(ctx *CTX) error) {
+	if g.sem != nil {
+		select {
+		case g.sem <- struct{}{}:
+		case <-g.done.Done():
+			g.fail(g.done.Err())
+			return
+		}
+	}
+	if g.done.Err() != nil {
+		g.release()
+		g.fail(g.done.Err())
+		return
+	}
+
+	child := g.ctx.Clone()
+	child.SetContext(g.done)
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer g.release()
+		if err := runJob(child, job); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Wait blocks until all jobs are done, and returns the first error. Jobs canceled after it are not reported.
+func (g *JobGroup) Wait() ErrorType {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
+
+func (g *JobGroup) release() {
+	if g.sem != nil {
+		<-g.sem
+	}
+}
+
+// fail records the first error and cancels the other jobs.
+func (g *JobGroup) fail(err any) {
+	g.errOnce.Do(func() {
+		g.err = errorTypeOf(err)
+		g.cancel()
+	})
+}
+
+// runJob returns error of job, or the recovered panic, which is logged.
+func runJob(ctx *CTX, job func(ctx *CTX) error) (err any) {
+	defer func() {
+		if p := recover(); p != nil {
+			logRecovered(ctx, p)
+			err = p
+		}
+	}()
+	if e := job(ctx); e != nil {
+		return e
+	}
+	return nil
+}
+
+// ParallelMap calls fn with every item concurrently, at most limit at a time, and returns results in order of items.
+// It fails fast as JobGroup does, results are nil if any call fails.
+//
+//	users, err := xf.ParallelMap(ctx, 8, ids, func(ctx *xf.CTX, id string) (*User, error) {
+//		return userDAO(ctx).MustGet(id), nil
+//	})
+func ParallelMap[T, R any](ctx *CTX, limit int, items []T, fn func(ctx *CTX, item T) (R, error)) ([]R, ErrorType) {
+	results := make([]R, len(items))
+	g := NewJobGroup(ctx, limit)
+	for i, item := range items {
+		i, item := i, item
+		g.Go(func(ctx *CTX) error {
+			r, err := fn(ctx, item)
+			if err != nil {
+				return err
+			}
+			results[i] = r
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
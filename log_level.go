@@ -0,0 +1,234 @@
+package xf
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogLevel is the global level shared by all loggers, including those captured before ConfigLogger.
+// Change it by SetLogLevel, or by the handler of RegisterLogLevelHandler at runtime.
+var LogLevel = zap.NewAtomicLevelAt(zap.DebugLevel)
+
+// coreLevel is the lowest level of LogLevel and module levels, used by cores.
+// Entries passing coreLevel are filtered again by the level of their module. See moduleLevelCore.
+var coreLevel = zap.NewAtomicLevelAt(zap.DebugLevel)
+
+var moduleLevels = struct {
+	sync.RWMutex
+	levels map[string]zapcore.Level
+	// reverts are pending reverts of levels changed by the handler of RegisterLogLevelHandler.
+	reverts map[string]*pendingLogLevelRevert
+}{levels: map[string]zapcore.Level{}, reverts: map[string]*pendingLogLevelRevert{}}
+
+type pendingLogLevelRevert struct {
+	timer  *time.Timer
+	revert func()
+}
+
+// ModuleLogger returns Logger named module. Its level can be overridden by SetModuleLogLevel.
+// Modules are hierarchical by dots, e.g. level of "grpc" applies to "grpc.client" unless "grpc.client" is set.
+func ModuleLogger(module string) *zap.Logger {
+	return CurrentLogger().Named(module)
+}
+
+// SetLogLevel sets the global level without rebuilding Logger.
+func SetLogLevel(level zapcore.Level) {
+	LogLevel.SetLevel(level)
+	updateCoreLevel()
+}
+
+// SetModuleLogLevel overrides the level of module and its sub modules.
+func SetModuleLogLevel(module string, level zapcore.Level) {
+	moduleLevels.Lock()
+	moduleLevels.levels[module] = level
+	moduleLevels.Unlock()
+	updateCoreLevel()
+}
+
+// ResetModuleLogLevel removes the override of module, so that it follows its parent module or LogLevel.
+func ResetModuleLogLevel(module string) {
+	moduleLevels.Lock()
+	delete(moduleLevels.levels, module)
+	moduleLevels.Unlock()
+	updateCoreLevel()
+}
+
+// ModuleLogLevels returns overridden levels by module.
+func ModuleLogLevels() map[string]zapcore.Level {
+	moduleLevels.RLock()
+	defer moduleLevels.RUnlock()
+
+	levels := make(map[string]zapcore.Level, len(moduleLevels.levels))
+	for module, level := range moduleLevels.levels {
+		levels[module] = level
+	}
+	return levels
+}
+
+// ModuleLogLevel returns the effective level of module. "" is the global level.
+func ModuleLogLevel(module string) zapcore.Level {
+	moduleLevels.RLock()
+	defer moduleLevels.RUnlock()
+
+	for module != "" {
+		if level, ok := moduleLevels.levels[module]; ok {
+			return level
+		}
+		i := strings.LastIndexByte(module, '.')
+		if i < 0 {
+			break
+		}
+		module = module[:i]
+	}
+	return LogLevel.Level()
+}
+
+func updateCoreLevel() {
+	moduleLevels.RLock()
+	defer moduleLevels.RUnlock()
+
+	level := LogLevel.Level()
+	for _, l := range moduleLevels.levels {
+		if l < level {
+			level = l
+		}
+	}
+	coreLevel.SetLevel(level)
+}
+
+// moduleLevelCore filters entries by the level of their logger name.
+type moduleLevelCore struct {
+	zapcore.Core
+}
+
+func (r *moduleLevelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &moduleLevelCore{Core: r.Core.With(fields)}
+}
+
+func (r *moduleLevelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.LoggerName == "" {
+		if !LogLevel.Enabled(ent.Level) {
+			return ce
+		}
+	} else if !ModuleLogLevel(ent.LoggerName).Enabled(ent.Level) {
+		return ce
+	}
+	return r.Core.Check(ent, ce)
+}
+
+// LogLevelRequest changes the level of Module, or the global level if Module is empty.
+type LogLevelRequest struct {
+	Module string `json:"module"`
+	// Level is one of debug, info, warn, error, dpanic, panic and fatal. Empty resets the override of Module.
+	Level string `json:"level"`
+	// RevertAfter reverts the change after the duration, e.g. "10m". Never if empty.
+	RevertAfter string `json:"revertAfter"`
+}
+
+// RegisterLogLevelHandler serves levels at path. Mount it on a protected group, e.g. admin.
+//
+//	GET path: {"level": "info", "modules": {"grpc": "debug"}}
+//	PUT path: body of LogLevelRequest, e.g. {"module": "grpc", "level": "debug", "revertAfter": "10m"}
+func RegisterLogLevelHandler(router gin.IRoutes, path string) {
+	router.GET(path, getLogLevelsHandler)
+	router.PUT(path, setLogLevelHandler)
+}
+
+func getLogLevelsHandler(c *gin.Context) {
+	modules := map[string]string{}
+	for module, level := range ModuleLogLevels() {
+		modules[module] = level.String()
+	}
+	c.JSON(200, gin.H{"level": LogLevel.Level().String(), "modules": modules})
+}
+
+func setLogLevelHandler(c *gin.Context) {
+	var req LogLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		panic(ErrParamBindingError(err))
+	}
+
+	var revertAfter time.Duration
+	if req.RevertAfter != "" {
+		d, err := time.ParseDuration(req.RevertAfter)
+		if err != nil || d <= 0 {
+			panic(ErrInvalidParameters("revertAfter"))
+		}
+		revertAfter = d
+	}
+
+	var level zapcore.Level
+	if req.Level != "" {
+		if err := level.UnmarshalText([]byte(req.Level)); err != nil {
+			panic(ErrInvalidParameters("level"))
+		}
+	} else if req.Module == "" {
+		panic(ErrInvalidParameters("level"))
+	}
+
+	revert := changeLogLevel(req.Module, req.Level != "", level)
+	scheduleLogLevelRevert(req.Module, revertAfter, revert)
+
+	getCTX(c).Logger().Warn("log level changed",
+		zap.String("module", req.Module), zap.String("level", req.Level), zap.Duration("revertAfter", revertAfter))
+	getLogLevelsHandler(c)
+}
+
+// changeLogLevel sets (or resets if !set) level of module, and returns a function restoring the previous one.
+func changeLogLevel(module string, set bool, level zapcore.Level) (revert func()) {
+	if module == "" {
+		previous := LogLevel.Level()
+		SetLogLevel(level)
+		return func() { SetLogLevel(previous) }
+	}
+
+	previous, overridden := ModuleLogLevels()[module]
+	if set {
+		SetModuleLogLevel(module, level)
+	} else {
+		ResetModuleLogLevel(module)
+	}
+	return func() {
+		if overridden {
+			SetModuleLogLevel(module, previous)
+		} else {
+			ResetModuleLogLevel(module)
+		}
+	}
+}
+
+// scheduleLogLevelRevert reverts the change of module after the duration. If a revert is pending, it's rescheduled
+// and still restores the level before the first change. A change without duration cancels the pending revert.
+func scheduleLogLevelRevert(module string, after time.Duration, revert func()) {
+	moduleLevels.Lock()
+	defer moduleLevels.Unlock()
+
+	if pending, ok := moduleLevels.reverts[module]; ok {
+		pending.timer.Stop()
+		delete(moduleLevels.reverts, module)
+		revert = pending.revert
+	}
+	if after <= 0 {
+		return
+	}
+
+	pending := &pendingLogLevelRevert{revert: revert}
+	pending.timer = time.AfterFunc(after, func() {
+		moduleLevels.Lock()
+		if moduleLevels.reverts[module] != pending {
+			moduleLevels.Unlock()
+			return
+		}
+		delete(moduleLevels.reverts, module)
+		moduleLevels.Unlock()
+
+		revert()
+		Warnf("log level of module %q reverted to %v", module, ModuleLogLevel(module))
+	})
+	moduleLevels.reverts[module] = pending
+}
@@ -0,0 +1,346 @@
+package xf
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RollingFileOptions configures NewRollingFile.
+type RollingFileOptions struct {
+	// Filename of the active log file, e.g. "./log/app.log". Rotated files are named like "app-20060102T150405.000.log".
+	Filename string
+	// MaxSizeMB rotates the file when it would exceed MaxSizeMB megabytes. 0 means no size limit.
+	MaxSizeMB int
+	// RotateInterval rotates the file at boundaries of the interval in local time, e.g. 24h rotates at midnight. 0 means no time-based rotation.
+	RotateInterval time.Duration
+	// MaxAge removes rotated files older than MaxAge. 0 means no limit.
+	MaxAge time.Duration
+	// MaxBackups is the max number of rotated files kept. 0 means no limit.
+	MaxBackups int
+	// Compress rotated files with gzip.
+	Compress bool
+}
+
+const rollingFileTimeFormat = "20060102T150405.000"
+
+// RollingFile is an io.WriteCloser rotating its file by size and time. Safe for concurrent use.
+type RollingFile struct {
+	opts RollingFileOptions
+
+	lock         sync.Mutex
+	file         *os.File
+	size         int64
+	nextRotation time.Time
+	closed       bool
+
+	// millCh serializes compression and removal of rotated files.
+	millCh   chan struct{}
+	millOnce sync.Once
+}
+
+func NewRollingFile(opts RollingFileOptions) *RollingFile {
+	if opts.Filename == "" {
+		panic(ErrServerInternalError(fmt.Errorf("filename of rolling file is empty")))
+	}
+	return &RollingFile{opts: opts}
+}
+
+// Write writes p to the active file, rotating it before writing if needed.
+// Returns os.ErrClosed after Close.
+func (r *RollingFile) Write(p []byte) (n int, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.file == nil {
+		if err = r.openExisting(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.shouldRotate(int64(len(p))) {
+		if err = r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Sync commits the active file to disk.
+func (r *RollingFile) Sync() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Sync()
+}
+
+// Rotate closes the active file, renames it to a backup and opens a new one.
+func (r *RollingFile) Rotate() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return os.ErrClosed
+	}
+	if r.file == nil {
+		if err := r.openExisting(); err != nil {
+			return err
+		}
+	}
+	return r.rotate()
+}
+
+// Close closes the active file. The file is not reopened by Write or Rotate afterwards.
+func (r *RollingFile) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.closed = true
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// setOptions replaces options of the same Filename, on reloading Logger. Filename is never changed.
+func (r *RollingFile) setOptions(opts RollingFileOptions) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	interval := r.opts.RotateInterval
+	r.opts.MaxSizeMB = opts.MaxSizeMB
+	r.opts.RotateInterval = opts.RotateInterval
+	r.opts.MaxAge = opts.MaxAge
+	r.opts.MaxBackups = opts.MaxBackups
+	r.opts.Compress = opts.Compress
+	if r.file != nil && opts.RotateInterval != interval {
+		r.nextRotation = r.nextRotationAfter(time.Now())
+	}
+}
+
+func (r *RollingFile) shouldRotate(n int64) bool {
+	if r.opts.MaxSizeMB > 0 && r.size > 0 && r.size+n > int64(r.opts.MaxSizeMB)*1024*1024 {
+		return true
+	}
+	return r.opts.RotateInterval > 0 && !time.Now().Before(r.nextRotation)
+}
+
+// openExisting appends to the file left by the previous process. The rotation time is counted from its last write.
+func (r *RollingFile) openExisting() error {
+	if err := os.MkdirAll(filepath.Dir(r.opts.Filename), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(r.opts.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	r.file = f
+	r.size = info.Size()
+	r.nextRotation = r.nextRotationAfter(info.ModTime())
+	return nil
+}
+
+func (r *RollingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+
+	now := time.Now()
+	if err := os.Rename(r.opts.Filename, r.backupName(now)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(r.opts.Filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	r.file = f
+	r.size = 0
+	r.nextRotation = r.nextRotationAfter(now)
+
+	r.mill()
+	return nil
+}
+
+// nextRotationAfter returns the next boundary of RotateInterval in local time.
+func (r *RollingFile) nextRotationAfter(t time.Time) time.Time {
+	if r.opts.RotateInterval <= 0 {
+		return time.Time{}
+	}
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(r.opts.RotateInterval).Add(r.opts.RotateInterval).Add(-shift)
+}
+
+func (r *RollingFile) prefixAndExt() (prefix, ext string) {
+	base := filepath.Base(r.opts.Filename)
+	ext = filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "-", ext
+}
+
+func (r *RollingFile) backupName(t time.Time) string {
+	prefix, ext := r.prefixAndExt()
+	return filepath.Join(filepath.Dir(r.opts.Filename), prefix+t.Format(rollingFileTimeFormat)+ext)
+}
+
+// mill wakes the mill goroutine. Rotations during milling are merged into one run.
+func (r *RollingFile) mill() {
+	r.millOnce.Do(func() {
+		r.millCh = make(chan struct{}, 1)
+		go func() {
+			for range r.millCh {
+				if err := r.millRun(); err != nil {
+					Errorf("failed to clean up rotated logs of %v. %v", r.opts.Filename, err)
+				}
+			}
+		}()
+	})
+
+	select {
+	case r.millCh <- struct{}{}:
+	default:
+	}
+}
+
+type rotatedLogFile struct {
+	path       string
+	rotatedAt  time.Time
+	compressed bool
+}
+
+// millRun removes rotated files exceeding MaxBackups or MaxAge, then compresses the rest.
+func (r *RollingFile) millRun() error {
+	files, err := r.rotatedFiles()
+	if err != nil {
+		return err
+	}
+
+	// options could be replaced by setOptions
+	r.lock.Lock()
+	opts := r.opts
+	r.lock.Unlock()
+
+	var remaining []rotatedLogFile
+	cutoff := time.Now().Add(-opts.MaxAge)
+	for i, f := range files {
+		if (opts.MaxBackups > 0 && i >= opts.MaxBackups) || (opts.MaxAge > 0 && f.rotatedAt.Before(cutoff)) {
+			if err = os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		remaining = append(remaining, f)
+	}
+
+	if !opts.Compress {
+		return nil
+	}
+	for _, f := range remaining {
+		if f.compressed {
+			continue
+		}
+		if err = gzipFile(f.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rotatedFiles returns rotated files, newest first.
+func (r *RollingFile) rotatedFiles() ([]rotatedLogFile, error) {
+	entries, err := os.ReadDir(filepath.Dir(r.opts.Filename))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, ext := r.prefixAndExt()
+	var files []rotatedLogFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		compressed := strings.HasSuffix(name, ext+".gz")
+		ts := strings.TrimPrefix(name, prefix)
+		if compressed {
+			ts = strings.TrimSuffix(ts, ext+".gz")
+		} else if strings.HasSuffix(ts, ext) {
+			ts = strings.TrimSuffix(ts, ext)
+		} else {
+			continue
+		}
+		t, err := time.ParseInLocation(rollingFileTimeFormat, ts, time.Local)
+		if err != nil {
+			continue
+		}
+		files = append(files, rotatedLogFile{
+			path:       filepath.Join(filepath.Dir(r.opts.Filename), name),
+			rotatedAt:  t,
+			compressed: compressed,
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].rotatedAt.After(files[j].rotatedAt)
+	})
+	return files, nil
+}
+
+// gzipFile compresses file to file.gz and removes file.
+func gzipFile(file string) (err error) {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(file+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = dst.Close()
+			_ = os.Remove(file + ".gz")
+		}
+	}()
+
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	_ = src.Close()
+	return os.Remove(file)
+}
@@ -1,55 +1,95 @@
 package xf
 
 import (
+	"fmt"
 	"runtime"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+// Logger and L are replaced by ConfigLogger. Read them by CurrentLogger and CurrentSugaredLogger,
+// if loggers could be reloaded concurrently.
 var L *zap.SugaredLogger
 
 var Logger *zap.Logger
 
+// globalLoggers publishes Logger and L atomically.
+var globalLoggers atomic.Pointer[globalLoggerSet]
+
+type globalLoggerSet struct {
+	logger *zap.Logger
+	sugar  *zap.SugaredLogger
+}
+
+// CurrentLogger returns Logger of the last ConfigLogger. Safe for concurrent use with ConfigLogger.
+func CurrentLogger() *zap.Logger {
+	return globalLoggers.Load().logger
+}
+
+// CurrentSugaredLogger returns L of the last ConfigLogger. Safe for concurrent use with ConfigLogger.
+func CurrentSugaredLogger() *zap.SugaredLogger {
+	return globalLoggers.Load().sugar
+}
+
 //var DefaultLoggerConfig = zap.NewProductionConfig()
 
 //var DefaultLoggerConfig = zap.NewDevelopmentConfig()
 
-//var LogLevel = zap.DebugLevel
-
 func init() {
 	ReloadLogger(nil)
 }
 
-func ReloadLogger(custom func(config *zap.Config /*, rotationCfg *lumberjack.Logger*/)) {
+// LogOptions configures sinks besides outputs of zap.Config. See ReloadLogger and ConfigLogger.
+type LogOptions struct {
+	// DisableConsole drops outputs of zap.Config, so that logs are written to Files only.
+	DisableConsole bool
+	// Files are rolling file sinks, e.g. one for all levels and one for errors only.
+	Files []LogFileSink
+}
+
+// LogFileSink writes logs of Levels to a RollingFile.
+type LogFileSink struct {
+	RollingFileOptions
+	// Levels written to the file. All levels enabled by zap.Config.Level if empty.
+	Levels []zapcore.Level
+	// Encoding is "json" or "console". Defaults to "json".
+	Encoding string
+}
+
+// logFiles are opened by the current Logger. Files of the same name are kept on reloading, others are closed.
+var logFiles []*RollingFile
+var logFilesLock sync.Mutex
+
+// ReloadLogger rebuilds Logger from the default console config, customized by custom. e.g.
+//
+//	xf.ReloadLogger(func(config *zap.Config, options *xf.LogOptions) {
+//		config.Sampling = &zap.SamplingConfig{Initial: 100, Thereafter: 100}
+//		options.Files = []xf.LogFileSink{
+//			{RollingFileOptions: xf.RollingFileOptions{Filename: "./log/app.log", MaxSizeMB: 100, RotateInterval: 24 * time.Hour, MaxAge: 30 * 24 * time.Hour, Compress: true}},
+//			{RollingFileOptions: xf.RollingFileOptions{Filename: "./log/error.log", MaxSizeMB: 100, MaxBackups: 10}, Levels: []zapcore.Level{zap.ErrorLevel}},
+//		}
+//	})
+func ReloadLogger(custom func(config *zap.Config, options *LogOptions)) {
 	var config = zap.NewProductionConfig()
 	config.Encoding = "console"
-	config.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
+	// keeps the level set at runtime
+	config.Level = zap.NewAtomicLevelAt(LogLevel.Level())
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	config.EncoderConfig.EncodeCaller = nil
 
-	//rotationCfg := &lumberjack.Logger{
-	//	Filename: "./log/app.log",
-	//	MaxSize:  10,              // mb
-	//	MaxAge:   30,              // days
-	//}
+	options := &LogOptions{}
 
 	if custom != nil {
-		custom(&config)
+		custom(&config, options)
 	}
 
-	//core := zapcore.NewCore(
-	//	zapcore.NewConsoleEncoder(config.EncoderConfig),
-	//	zapcore.AddSync(rotationCfg),
-	//	config.Level,
-	//)
-	//
-	//logger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip())
-
-	Logger, _ = config.Build()
-	L = Logger.Sugar()
+	ConfigLogger(config, options)
 }
 
 func LogLevelOfString(str string) zapcore.Level {
@@ -73,63 +113,162 @@ func LogLevelOfString(str string) zapcore.Level {
 	return zapcore.InfoLevel
 }
 
-func SetLogLevel(level zapcore.Level) {
-	ReloadLogger(func(config *zap.Config) {
-		config.Level = zap.NewAtomicLevelAt(level)
-	})
+// ConfigLogger builds Logger from config, plus file sinks of options. options can be nil.
+// Sampling of config applies to every sink. Files of the previous Logger are kept if they are still configured,
+// so that loggers derived before, e.g. by ModuleLogger, keep writing to them. Others are closed.
+// LogLevel is set to config.Level, and shared by Logger, so that SetLogLevel applies to loggers built before.
+func ConfigLogger(config zap.Config, options *LogOptions) {
+	SetLogLevel(config.Level.Level())
+	config.Level = coreLevel
+
+	logger, err := config.Build()
+	if err != nil {
+		panic(ErrServerInternalError(fmt.Errorf("failed to build logger. %v", err)))
+	}
+
+	logFilesLock.Lock()
+	defer logFilesLock.Unlock()
+
+	var files []*RollingFile
+	if options != nil && (len(options.Files) > 0 || options.DisableConsole) {
+		var cores []zapcore.Core
+		for _, sink := range options.Files {
+			file := findLogFile(logFiles, sink.Filename)
+			if file != nil {
+				file.setOptions(sink.RollingFileOptions)
+			} else {
+				file = NewRollingFile(sink.RollingFileOptions)
+			}
+			files = append(files, file)
+			cores = append(cores, newFileLogCore(config, sink, file))
+		}
+
+		disableConsole := options.DisableConsole
+		logger = logger.WithOptions(zap.WrapCore(func(console zapcore.Core) zapcore.Core {
+			if disableConsole {
+				return zapcore.NewTee(cores...)
+			}
+			return zapcore.NewTee(append([]zapcore.Core{console}, cores...)...)
+		}))
+	}
+
+	// cores are enabled at coreLevel, the lowest of all levels. filter by levels of modules for every sink.
+	logger = logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &moduleLevelCore{Core: core}
+	}))
+
+	oldFiles := logFiles
+	Logger = logger
+	L = logger.Sugar()
+	globalLoggers.Store(&globalLoggerSet{logger: Logger, sugar: L})
+	logFiles = files
+
+	for _, f := range oldFiles {
+		if findLogFile(files, f.opts.Filename) == f {
+			continue
+		}
+		_ = f.Sync()
+		_ = f.Close()
+	}
 }
 
-func ConfigLogger(config zap.Config) {
-	Logger, _ = config.Build()
-	L = Logger.Sugar()
+func findLogFile(files []*RollingFile, filename string) *RollingFile {
+	for _, f := range files {
+		if f.opts.Filename == filename {
+			return f
+		}
+	}
+	return nil
+}
+
+// SyncLogger flushes buffered logs. Call it before exit.
+func SyncLogger() {
+	_ = CurrentLogger().Sync()
+}
+
+func newFileLogCore(config zap.Config, sink LogFileSink, file *RollingFile) zapcore.Core {
+	encoderConfig := config.EncoderConfig
+	// no color in files
+	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	if encoderConfig.EncodeCaller == nil {
+		encoderConfig.CallerKey = zapcore.OmitKey
+	}
+
+	var encoder zapcore.Encoder
+	if sink.Encoding == "console" {
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	} else {
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	}
+
+	enabler := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		if !config.Level.Enabled(l) {
+			return false
+		}
+		if len(sink.Levels) == 0 {
+			return true
+		}
+		for _, level := range sink.Levels {
+			if level == l {
+				return true
+			}
+		}
+		return false
+	})
+
+	core := zapcore.NewCore(encoder, zapcore.AddSync(file), enabler)
+	if config.Sampling != nil {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, config.Sampling.Initial, config.Sampling.Thereafter)
+	}
+	return core
 }
 
 func Debug(args ...interface{}) {
-	L.Debug(args...)
+	CurrentSugaredLogger().Debug(args...)
 }
 
 func Info(args ...interface{}) {
-	L.Info(args...)
+	CurrentSugaredLogger().Info(args...)
 }
 
 func Warn(args ...interface{}) {
-	L.Warn(args...)
+	CurrentSugaredLogger().Warn(args...)
 }
 
 func Error(args ...interface{}) {
-	L.Error(args...)
+	CurrentSugaredLogger().Error(args...)
 }
 
 func Panic(args ...interface{}) {
-	L.Panic(args...)
+	CurrentSugaredLogger().Panic(args...)
 }
 
 func Fatal(args ...interface{}) {
-	L.Fatal(args...)
+	CurrentSugaredLogger().Fatal(args...)
 }
 
 func Debugf(template string, args ...interface{}) {
-	L.Debugf(template, args...)
+	CurrentSugaredLogger().Debugf(template, args...)
 }
 
 func Infof(template string, args ...interface{}) {
-	L.Infof(template, args...)
+	CurrentSugaredLogger().Infof(template, args...)
 }
 
 func Warnf(template string, args ...interface{}) {
-	L.Warnf(template, args...)
+	CurrentSugaredLogger().Warnf(template, args...)
 }
 
 func Errorf(template string, args ...interface{}) {
-	L.Errorf(template, args...)
+	CurrentSugaredLogger().Errorf(template, args...)
 }
 
 func Panicf(template string, args ...interface{}) {
-	L.Panicf(template, args...)
+	CurrentSugaredLogger().Panicf(template, args...)
 }
 
 func Fatalf(template string, args ...interface{}) {
-	L.Fatalf(template, args...)
+	CurrentSugaredLogger().Fatalf(template, args...)
 }
 
 func FileWithLineNumber(index int) string {
@@ -0,0 +1,107 @@
+package xf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRollingFileClosed(t *testing.T) {
+	f := NewRollingFile(RollingFileOptions{Filename: filepath.Join(t.TempDir(), "app.log")})
+	if _, err := f.Write([]byte("a\n")); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if _, err := f.Write([]byte("b\n")); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("err = %v, want os.ErrClosed", err)
+	}
+	if err := f.Rotate(); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("err = %v, want os.ErrClosed", err)
+	}
+}
+
+func TestConfigLoggerKeepsFiles(t *testing.T) {
+	defer ReloadLogger(nil)
+
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "app.log")
+	dropped := filepath.Join(dir, "old.log")
+
+	ReloadLogger(func(config *zap.Config, options *LogOptions) {
+		options.DisableConsole = true
+		options.Files = []LogFileSink{
+			{RollingFileOptions: RollingFileOptions{Filename: kept}},
+			{RollingFileOptions: RollingFileOptions{Filename: dropped}},
+		}
+	})
+	derived := ModuleLogger("test")
+
+	ReloadLogger(func(config *zap.Config, options *LogOptions) {
+		options.DisableConsole = true
+		options.Files = []LogFileSink{{RollingFileOptions: RollingFileOptions{Filename: kept}}}
+	})
+	derived.Info("derived before reloading")
+	CurrentLogger().Info("after reloading")
+	SyncLogger()
+
+	bytes, err := os.ReadFile(kept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{"derived before reloading", "after reloading"} {
+		if !strings.Contains(string(bytes), msg) {
+			t.Fatalf("%q not written to %v", msg, kept)
+		}
+	}
+
+	bytes, err = os.ReadFile(dropped)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(bytes), "derived before reloading") {
+		t.Fatalf("closed file %v is reopened", dropped)
+	}
+}
+
+func TestFileSinkRespectsModuleLevels(t *testing.T) {
+	level := LogLevel.Level()
+	defer func() {
+		ResetModuleLogLevel("grpc")
+		SetLogLevel(level)
+		ReloadLogger(nil)
+	}()
+
+	file := filepath.Join(t.TempDir(), "app.log")
+	ReloadLogger(func(config *zap.Config, options *LogOptions) {
+		config.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
+		options.DisableConsole = true
+		options.Files = []LogFileSink{{RollingFileOptions: RollingFileOptions{Filename: file}}}
+	})
+	SetModuleLogLevel("grpc", zap.DebugLevel)
+
+	CurrentLogger().Debug("debug of global")
+	ModuleLogger("mongo").Debug("debug of mongo")
+	ModuleLogger("grpc.client").Debug("debug of grpc")
+	CurrentLogger().Info("info of global")
+	SyncLogger()
+
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for msg, expected := range map[string]bool{
+		"debug of global": false,
+		"debug of mongo":  false,
+		"debug of grpc":   true,
+		"info of global":  true,
+	} {
+		if strings.Contains(string(bytes), msg) != expected {
+			t.Fatalf("%q written = %v, want %v", msg, !expected, expected)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package xf
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Masker partially masks a value for output. Masker should be idempotent,
+// because a value might be masked more than once, e.g. by a handler and API.
+type Masker func(value string) string
+
+// DefaultUnmaskPermission allows a principal to see values of fields tagged with xf:"mask:xxx" in full.
+var DefaultUnmaskPermission = "unmask"
+
+const maskChar = "*"
+
+var maskers = map[string]Masker{
+	// 138****1234
+	"phone": func(v string) string {
+		return maskMiddle(v, 3, 4)
+	},
+	// 110***********1234
+	"idcard": func(v string) string {
+		return maskMiddle(v, 3, 4)
+	},
+	// ************1234
+	"bankcard": func(v string) string {
+		return maskMiddle(v, 0, 4)
+	},
+	// a***@example.com
+	"email": func(v string) string {
+		at := strings.LastIndex(v, "@")
+		if at <= 0 {
+			return maskMiddle(v, 1, 0)
+		}
+		r := []rune(v[:at])
+		return string(r[:1]) + strings.Repeat(maskChar, 3) + v[at:]
+	},
+	// 张**
+	"name": func(v string) string {
+		return maskMiddle(v, 1, 0)
+	},
+	// ******
+	"all": func(v string) string {
+		if v == "" {
+			return v
+		}
+		return RedactedMask
+	},
+}
+var maskersLock sync.RWMutex
+
+// RegisterMasker registers a masker which can be used by tag xf:"mask:name". Builtin maskers can be replaced.
+func RegisterMasker(name string, masker Masker) {
+	maskersLock.Lock()
+	defer maskersLock.Unlock()
+	maskers[name] = masker
+}
+
+func getMasker(name string) Masker {
+	maskersLock.RLock()
+	defer maskersLock.RUnlock()
+	return maskers[name]
+}
+
+// maskMiddle keeps head and tail characters and replaces the others with '*'.
+// If value is too short, keeps less characters.
+func maskMiddle(v string, head, tail int) string {
+	r := []rune(v)
+	n := len(r)
+	if n == 0 {
+		return v
+	}
+	for head+tail >= n && (head > 0 || tail > 0) {
+		if tail >= head && tail > 0 {
+			tail--
+		} else {
+			head--
+		}
+	}
+	return string(r[:head]) + strings.Repeat(maskChar, n-head-tail) + string(r[n-tail:])
+}
+
+// maskedField is a string field tagged with xf:"mask:xxx".
+type maskedField struct {
+	index  []int
+	masker string
+}
+
+// maskPlan caches masked fields and nested fields to visit of a struct type.
+type maskPlan struct {
+	fields []maskedField
+	nested [][]int
+}
+
+var maskPlans sync.Map // reflect.Type -> *maskPlan
+
+func maskPlanOf(t reflect.Type) *maskPlan {
+	if v, ok := maskPlans.Load(t); ok {
+		return v.(*maskPlan)
+	}
+
+	plan := &maskPlan{}
+	buildMaskPlan(t, nil, plan, map[reflect.Type]bool{})
+	maskPlans.Store(t, plan)
+	return plan
+}
+
+func buildMaskPlan(t reflect.Type, prefix []int, plan *maskPlan, visiting map[reflect.Type]bool) {
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		index := append(append([]int(nil), prefix...), i)
+
+		for _, opt := range strings.Split(field.Tag.Get("xf"), ",") {
+			kv := strings.Split(opt, ":")
+			if kv[0] == "mask" && len(kv) > 1 && isStringOrStringPtr(field.Type) {
+				plan.fields = append(plan.fields, maskedField{index: index, masker: kv[1]})
+			}
+		}
+
+		tt := field.Type
+		for tt.Kind() == reflect.Ptr {
+			tt = tt.Elem()
+		}
+
+		switch {
+		case field.Anonymous && field.Type.Kind() == reflect.Struct && !visiting[tt]:
+			// fields of embedded struct are promoted.
+			buildMaskPlan(tt, index, plan, visiting)
+		case tt.Kind() == reflect.Struct, tt.Kind() == reflect.Slice, tt.Kind() == reflect.Array, tt.Kind() == reflect.Map:
+			plan.nested = append(plan.nested, index)
+		}
+	}
+}
+
+func isStringOrStringPtr(t reflect.Type) bool {
+	return t.Kind() == reflect.String || (t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.String)
+}
+
+// ApplyMasks masks fields tagged with xf:"mask:xxx" in place.
+// v can be a pointer to struct, or a slice/array/map of them.
+func ApplyMasks(v any) {
+	if v == nil {
+		return
+	}
+	applyMasks(reflect.ValueOf(v), 0)
+}
+
+const maxMaskDepth = 8
+
+func applyMasks(v reflect.Value, depth int) {
+	if depth > maxMaskDepth {
+		return
+	}
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			applyMasks(v.Index(i), depth+1)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			mv := iter.Value()
+			e := mv
+			for e.Kind() == reflect.Interface && !e.IsNil() {
+				e = e.Elem()
+			}
+			if (e.Kind() != reflect.Struct && e.Kind() != reflect.Array) || !e.CanInterface() {
+				applyMasks(mv, depth+1)
+				continue
+			}
+			if e.Kind() == reflect.Struct {
+				if plan := maskPlanOf(e.Type()); len(plan.fields) == 0 && len(plan.nested) == 0 {
+					continue
+				}
+			}
+			// map values are not addressable. mask a copy and write it back.
+			cp := reflect.New(e.Type()).Elem()
+			cp.Set(e)
+			applyMasks(cp, depth+1)
+			v.SetMapIndex(iter.Key(), cp)
+		}
+	case reflect.Struct:
+		if !v.CanSet() {
+			return
+		}
+		plan := maskPlanOf(v.Type())
+		for _, f := range plan.fields {
+			maskField(v, f)
+		}
+		for _, index := range plan.nested {
+			if fv, ok := fieldByIndex(v, index); ok {
+				applyMasks(fv, depth+1)
+			}
+		}
+	}
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, but returns false on nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			for v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}, false
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func maskField(v reflect.Value, f maskedField) {
+	fv, ok := fieldByIndex(v, f.index)
+	if !ok {
+		return
+	}
+
+	masker := getMasker(f.masker)
+	if masker == nil {
+		// unknown masker. hide the value rather than leaking it.
+		masker = getMasker("all")
+	}
+
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return
+		}
+		// don't modify the string shared by pointer.
+		s := masker(fv.Elem().String())
+		fv.Set(reflect.ValueOf(&s))
+		return
+	}
+
+	fv.SetString(masker(fv.String()))
+}
+
+// MaskOutput masks v unless principal of ctx has the permission.
+// DefaultUnmaskPermission is used if permission is empty.
+func MaskOutput(ctx *CTX, permission string, v any) {
+	if permission == "" {
+		permission = DefaultUnmaskPermission
+	}
+	if ctx != nil && ctx.Principal().HasPermission(permission) {
+		return
+	}
+	ApplyMasks(v)
+}
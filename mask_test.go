@@ -0,0 +1,68 @@
+package xf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type maskTestModel struct {
+	Phone string `json:"phone" xf:"mask:phone"`
+}
+
+func TestApplyMasksMapValues(t *testing.T) {
+	const phone = "13812345678"
+
+	byValue := map[string]maskTestModel{"a": {Phone: phone}}
+	ApplyMasks(byValue)
+	if byValue["a"].Phone == phone {
+		t.Fatal("struct value of map is not masked")
+	}
+
+	anyValue := map[string]any{"a": maskTestModel{Phone: phone}}
+	ApplyMasks(anyValue)
+	if anyValue["a"].(maskTestModel).Phone == phone {
+		t.Fatal("struct in interface value of map is not masked")
+	}
+
+	arrayValue := map[string][1]maskTestModel{"a": {{Phone: phone}}}
+	ApplyMasks(arrayValue)
+	if arrayValue["a"][0].Phone == phone {
+		t.Fatal("array value of map is not masked")
+	}
+
+	pointer := map[string]*maskTestModel{"a": {Phone: phone}}
+	ApplyMasks(pointer)
+	if pointer["a"].Phone == phone {
+		t.Fatal("pointer value of map is not masked")
+	}
+}
+
+func TestAPIMaskOutputIgnoresUnverifiedJWT(t *testing.T) {
+	const phone = "13812345678"
+	// {"permissions":["unmask"]}, not signed
+	forged := "Bearer eyJhbGciOiJub25lIn0.eyJwZXJtaXNzaW9ucyI6WyJ1bm1hc2siXX0."
+
+	for _, authorization := range []string{forged, "Bearer malformed"} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.Header.Set("Authorization", authorization)
+
+		data := &maskTestModel{Phone: phone}
+		(&API[maskTestModel]{}).maskOutput(NewGinHelper(c), data)
+		if data.Phone == phone {
+			t.Fatalf("unmasked with %q", authorization)
+		}
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	SetVerifiedClaims(c, map[string]any{ClaimPermissions: []any{DefaultUnmaskPermission}})
+	data := &maskTestModel{Phone: phone}
+	(&API[maskTestModel]{}).maskOutput(NewGinHelper(c), data)
+	if data.Phone != phone {
+		t.Fatal("masked for verified principal")
+	}
+}
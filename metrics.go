@@ -0,0 +1,183 @@
+package xf
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// MetricsNamespace prefixes names of metrics.
+const MetricsNamespace = "xf"
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Total number of http requests by route template and status.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of http requests by route template and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	httpRequestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricsNamespace,
+		Name:      "http_requests_in_flight",
+		Help:      "Number of http requests being served.",
+	}, []string{"method", "route"})
+
+	daoOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Name:      "dao_operation_duration_seconds",
+		Help:      "Latency of mongo commands and sql statements by collection (or table) and operation.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"db", "collection", "operation", "result"})
+
+	daoSlowQueriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Name:      "dao_slow_queries_total",
+		Help:      "Total number of queries slower than SlowSQLDuration (level=slow) or VerySlowSQLDuration (level=very_slow).",
+	}, []string{"db", "collection", "operation", "level"})
+)
+
+func init() {
+	prometheus.MustRegister(httpRequestsTotal, httpRequestDuration, httpRequestsInFlight, daoOperationDuration, daoSlowQueriesTotal)
+}
+
+// GinMetricsMiddleware records http metrics by route template, e.g. "/api/device/:id".
+// Unmatched routes are labeled "unmatched", so that cardinality is bounded.
+func GinMetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+
+		inFlight := httpRequestsInFlight.WithLabelValues(method, route)
+		inFlight.Inc()
+		begin := time.Now()
+
+		defer func() {
+			inFlight.Dec()
+			status := strconv.Itoa(c.Writer.Status())
+			httpRequestsTotal.WithLabelValues(method, route, status).Inc()
+			httpRequestDuration.WithLabelValues(method, route, status).Observe(time.Since(begin).Seconds())
+		}()
+
+		c.Next()
+	}
+}
+
+// RegisterMetricsHandler serves metrics of the default prometheus registry at path, e.g. "/metrics".
+func RegisterMetricsHandler(router gin.IRoutes, path string) {
+	router.GET(path, gin.WrapH(promhttp.Handler()))
+}
+
+// ObserveDAOOperation records latency of a DAO operation, and counts slow queries by SlowSQLDuration and VerySlowSQLDuration.
+func ObserveDAOOperation(db, collection, operation string, elapsed time.Duration, failed bool) {
+	result := "ok"
+	if failed {
+		result = "error"
+	}
+	daoOperationDuration.WithLabelValues(db, collection, operation, result).Observe(elapsed.Seconds())
+
+	if elapsed >= VerySlowSQLDuration {
+		daoSlowQueriesTotal.WithLabelValues(db, collection, operation, "very_slow").Inc()
+	} else if elapsed >= SlowSQLDuration {
+		daoSlowQueriesTotal.WithLabelValues(db, collection, operation, "slow").Inc()
+	}
+}
+
+var sqlTableRegex = regexp.MustCompile("(?i)\\b(?:from|into|update|join)\\s+([`\\w.]+)")
+
+// sqlOperationAndTable returns the verb and the first table of query, e.g. "select", "device".
+func sqlOperationAndTable(query string) (operation, table string) {
+	query = strings.TrimSpace(query)
+	operation = query
+	if i := strings.IndexAny(query, " \n\t"); i > 0 {
+		operation = query[:i]
+	}
+	operation = strings.ToLower(operation)
+
+	if m := sqlTableRegex.FindStringSubmatch(query); len(m) > 1 {
+		table = strings.ReplaceAll(m[1], "`", "")
+	}
+	return
+}
+
+// MongoMetricsMonitor records latency of mongo commands by collection and command name.
+// Set it by options.Client().SetMonitor(xf.MongoCommandMonitors(xf.MongoMetricsMonitor(), ...)).
+func MongoMetricsMonitor() *event.CommandMonitor {
+	var collections sync.Map
+
+	observe := func(e event.CommandFinishedEvent, failed bool) {
+		collection := ""
+		if v, ok := collections.LoadAndDelete(mongoRequestKey{e.ConnectionID, e.RequestID}); ok {
+			collection = v.(string)
+		}
+		ObserveDAOOperation("mongo", collection, e.CommandName, time.Duration(e.DurationNanos), failed)
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			collections.Store(mongoRequestKey{e.ConnectionID, e.RequestID}, mongoCollectionOf(e))
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			observe(e.CommandFinishedEvent, false)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			observe(e.CommandFinishedEvent, true)
+		},
+	}
+}
+
+// mongoCollectionOf returns collection of command, which is the value of the first element, e.g. {"find": "device", ...}.
+func mongoCollectionOf(e *event.CommandStartedEvent) string {
+	elem, err := e.Command.IndexErr(0)
+	if err != nil {
+		return ""
+	}
+	if s, ok := elem.Value().StringValueOK(); ok {
+		return s
+	}
+	return ""
+}
+
+// MongoCommandMonitors combines monitors into one, since mongo client accepts only one.
+func MongoCommandMonitors(monitors ...*event.CommandMonitor) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			for _, m := range monitors {
+				if m != nil && m.Started != nil {
+					m.Started(ctx, e)
+				}
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			for _, m := range monitors {
+				if m != nil && m.Succeeded != nil {
+					m.Succeeded(ctx, e)
+				}
+			}
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			for _, m := range monitors {
+				if m != nil && m.Failed != nil {
+					m.Failed(ctx, e)
+				}
+			}
+		},
+	}
+}
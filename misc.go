@@ -2,9 +2,12 @@ package xf
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
 	"reflect"
+	"runtime/debug"
 	"strings"
 	"unsafe"
 )
@@ -56,7 +59,7 @@ func UUID4() string {
 	return uuid.NewString()[:4]
 }
 
-var shortUUIDConstraintError = NewErrorType("ShortUUIDConstraintError", 500, "length must be in [1, 32]")
+var shortUUIDConstraintError = ErrDefShortUUIDConstraintError.New(nil)
 
 // ShortUUID returns a certain length of UUID string.
 // length must between [1, 32].
@@ -80,11 +83,7 @@ func ShortUUID(length int) string {
 func AutoRecover(ctx *CTX, job func()) {
 	defer func() {
 		if err := recover(); err != nil {
-			var traceID string
-			if ctx != nil {
-				traceID = ctx.traceID
-			}
-			Errorf("[%v] %v", traceID, err)
+			logRecovered(ctx, err)
 		}
 	}()
 	job()
@@ -93,17 +92,41 @@ func AutoRecover(ctx *CTX, job func()) {
 func AutoRecoverReturns[T any](ctx *CTX, job func() T) T {
 	defer func() {
 		if err := recover(); err != nil {
-			var traceID string
-			if ctx != nil {
-				traceID = ctx.traceID
-			}
-			Errorf("[%v] %v", traceID, err)
+			logRecovered(ctx, err)
 		}
 	}()
 	return job()
 }
 
+// logRecovered logs a recovered panic. Stack is logged for 5xx ErrorType and any other panic.
+// Must be called by the deferred function, so that debug.Stack() contains the panic site.
+func logRecovered(ctx *CTX, err any) {
+	logger := ctx.Logger()
+	msg := fmt.Sprintf("%v", err)
+
+	et := TryConvertToErrorType(err)
+
+	if et != nil && et.StatusCode() < 500 {
+		logger.Error(msg)
+		return
+	}
+
+	stack := ErrorStackTrace(et)
+	if stack == "" {
+		stack = string(debug.Stack())
+	}
+
+	logger.Error(msg, zap.String("stack", stack))
+}
+
+// AutoRecoverAsync runs job in a new goroutine, and logs panics with ctx. ctx is shared with the goroutine,
+// pass ctx.Clone() if the job sets values of its own. See JobGroup for bounded jobs whose errors are waited for.
+// Since the job may outlive the request, ctx is detached from deadline and cancellation of the request.
+// DAO operations of the request made with ctx afterwards are not canceled with the request either.
 func AutoRecoverAsync(ctx *CTX, job func()) {
+	if ctx != nil {
+		ctx.detach()
+	}
 	go func() {
 		AutoRecover(ctx, job)
 	}()
@@ -109,6 +109,17 @@ func IndexUpdatedAt() mongo.IndexModel {
 	return indexUpdatedAt
 }
 
+// IndexText returns a text index on fields. A collection can have at most one text index.
+func IndexText(fields []string) mongo.IndexModel {
+	keys := make(bson.D, 0, len(fields))
+	for _, f := range fields {
+		keys = append(keys, bson.E{Key: f, Value: "text"})
+	}
+	return mongo.IndexModel{
+		Keys: keys,
+	}
+}
+
 type CommonModel[T any] interface {
 	ID
 	GetCreatedAt() *time.Time
@@ -253,7 +264,7 @@ var structFieldMapsLock sync.Mutex
 
 func parseXFTag2(t reflect.Type, dbTag string,
 	filterFields map[string][]string,
-	searchableFields []string,
+	searchableFields, textSearchFields *[]string,
 	listFields, detailFields map[string]any,
 	modFields map[string]struct{},
 ) {
@@ -272,7 +283,7 @@ func parseXFTag2(t reflect.Type, dbTag string,
 			}
 			switch tt.Kind() {
 			case reflect.Struct:
-				parseXFTag2(tt, dbTag, filterFields, searchableFields, listFields, detailFields, modFields)
+				parseXFTag2(tt, dbTag, filterFields, searchableFields, textSearchFields, listFields, detailFields, modFields)
 			}
 			continue
 		}
@@ -299,7 +310,10 @@ func parseXFTag2(t reflect.Type, dbTag string,
 			case "filter":
 				writeFilterFieldsMap(kv, fn, filterFields)
 			case "search":
-				searchableFields = append(searchableFields, fn)
+				*searchableFields = append(*searchableFields, fn)
+				if len(kv) > 1 && kv[1] == "text" {
+					*textSearchFields = append(*textSearchFields, fn)
+				}
 			case "omit":
 				writeOmitFieldsMap(kv, fn, listFields, detailFields, modFields)
 			}
@@ -312,6 +326,18 @@ func ParseXFTag(obj any, dbTag string) (
 	searchableFields []string,
 	listFields, detailFields map[string]any,
 	modFields map[string]struct{},
+) {
+	filterFields, searchableFields, _, listFields, detailFields, modFields = ParseXFTagWithTextSearch(obj, dbTag)
+	return
+}
+
+// ParseXFTagWithTextSearch is ParseXFTag, plus fields tagged with xf:"search:text".
+// These fields should be covered by a text index, see IndexText.
+func ParseXFTagWithTextSearch(obj any, dbTag string) (
+	filterFields map[string][]string,
+	searchableFields, textSearchFields []string,
+	listFields, detailFields map[string]any,
+	modFields map[string]struct{},
 ) {
 	t := reflect.TypeOf(obj)
 	filterFields = map[string][]string{}
@@ -319,7 +345,9 @@ func ParseXFTag(obj any, dbTag string) (
 	detailFields = map[string]any{}
 	modFields = map[string]struct{}{}
 
-	parseXFTag2(t, dbTag, filterFields, searchableFields, listFields, detailFields, modFields)
+	parseXFTag2(t, dbTag, filterFields, &searchableFields, &textSearchFields, listFields, detailFields, modFields)
+
+	RegisterSensitiveFields(obj)
 	return
 }
 
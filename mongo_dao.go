@@ -9,6 +9,7 @@ import (
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
 )
 
 type MongoDAO[T any, P CommonModel[T]] struct {
@@ -19,11 +20,16 @@ type MongoDAO[T any, P CommonModel[T]] struct {
 }
 
 func NewMongoDAO[T any, P CommonModel[T]](ctx *CTX, client *mongo.Client, collection *mongo.Collection) *MongoDAO[T, P] {
+	var sessionContext context.Context = context.Background()
+	if ctx != nil {
+		// carries span, deadline and CTX. See MongoTracingMonitor and MongoSlowQueryMonitor.
+		sessionContext = ctx
+	}
 	return &MongoDAO[T, P]{
 		CTX:            ctx,
 		client:         client,
 		collection:     collection,
-		sessionContext: context.Background(),
+		sessionContext: sessionContext,
 	}
 }
 
@@ -41,7 +47,7 @@ func (r *MongoDAO[T, P]) mapFields(m map[string]any) {
 //	total, err = r.collection.CountDocuments(r.sessionContext, filter)
 //
 //	if err != nil {
-//		panic(ErrMongoQueryError(err))
+//		panic(r.queryError(err))
 //	}
 //
 //	page.Total = &total
@@ -135,14 +141,14 @@ func (r *MongoDAO[T, P]) MustGetByAggregate2(paras *AggregateParameters, alterPi
 	cursor, err := r.collection.Aggregate(r.sessionContext, pipeline, opts)
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	data := make([]P, 0, cursor.RemainingBatchLength())
 	err = cursor.All(r.sessionContext, &data)
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	return data
@@ -184,14 +190,18 @@ func (r *MongoDAO[T, P]) pipelineFromPage(page *PageMeta) bson.A {
 	}
 	r.preprocessFilter(filter)
 
-	r.fixSearch(page.Search, filter)
+	r.fixSearch(page, filter)
 
 	pipeline = append(pipeline, bson.M{"$match": filter})
 
 	// sort
 	sort := page.SortBy
 	if len(sort) == 0 {
-		sort = bson.M{FieldID: -1}
+		if isTextSearch(page) {
+			sort = bson.M{TextScoreField: TextScoreMeta()}
+		} else {
+			sort = bson.M{FieldID: -1}
+		}
 	} else {
 		r.mapFields(sort)
 	}
@@ -230,12 +240,21 @@ func (r *MongoDAO[T, P]) filterFromPage(page *PageMeta) map[string]any {
 
 	r.preprocessFilter(filter)
 
-	r.fixSearch(page.Search, filter)
+	r.fixSearch(page, filter)
 
 	return filter
 }
 
-func (r *MongoDAO[T, P]) fixSearch(search, filter bson.M) {
+func (r *MongoDAO[T, P]) fixSearch(page *PageMeta, filter bson.M) {
+	mode := page.SearchMode.orDefault()
+
+	if mode == SearchModeText {
+		if text := TextSearchFilter(page.SearchText); text != nil {
+			filter["$text"] = text
+		}
+	}
+
+	search := page.Search
 	if search == nil {
 		return
 	}
@@ -243,27 +262,38 @@ func (r *MongoDAO[T, P]) fixSearch(search, filter bson.M) {
 	for k, v := range search {
 		switch v.(type) {
 		case bson.M: // $or $and
-			m := v.(bson.M)
-			a := make(bson.A, 0, len(m))
-			for mk, mv := range m {
-				a = append(a, bson.M{mk: primitive.Regex{Pattern: fmt.Sprintf("%v", mv)}})
-			}
-			filter[k] = a
+			r.fixSearchGroup(mode, k, v.(bson.M), filter)
 		case map[string]any: // $or $and
-			m := v.(map[string]any)
-			a := make(bson.A, 0, len(m))
-			for mk, mv := range m {
-				a = append(a, bson.M{mk: primitive.Regex{Pattern: fmt.Sprintf("%v", mv)}})
-			}
-			filter[k] = a
+			r.fixSearchGroup(mode, k, v.(map[string]any), filter)
 		case []any:
 			filter[k] = bson.M{"$in": v}
 		default:
-			filter[k] = primitive.Regex{Pattern: fmt.Sprintf("%v", v)}
+			filter[k] = SearchCondition(mode, v)
 		}
 	}
 }
 
+func (r *MongoDAO[T, P]) fixSearchGroup(mode SearchMode, op string, m map[string]any, filter bson.M) {
+	r.mapFields(m)
+
+	if mode == SearchModeTokens && op == "$or" {
+		// every token must be found in at least one of the fields.
+		and, _ := filter["$and"].(bson.A)
+		filter["$and"] = append(and, searchAcrossFields(mode, m)...)
+		return
+	}
+
+	a := make(bson.A, 0, len(m))
+	for mk, mv := range m {
+		a = append(a, bson.M{mk: SearchCondition(mode, mv)})
+	}
+	filter[op] = a
+}
+
+func isTextSearch(page *PageMeta) bool {
+	return page != nil && page.SearchMode == SearchModeText && TextSearchFilter(page.SearchText) != nil
+}
+
 func (r *MongoDAO[T, P]) MustGetPage(page *PageMeta, fields map[string]any) []P {
 	// filter
 	filter := r.filterFromPage(page)
@@ -272,9 +302,15 @@ func (r *MongoDAO[T, P]) MustGetPage(page *PageMeta, fields map[string]any) []P
 
 	r.configurePage(opt, page, filter)
 
+	textSearch := isTextSearch(page)
+
 	// sort
 	if len(page.SortBy) == 0 {
-		opt.SetSort(bson.M{FieldID: -1})
+		if textSearch {
+			opt.SetSort(bson.M{TextScoreField: TextScoreMeta()})
+		} else {
+			opt.SetSort(bson.M{FieldID: -1})
+		}
 	} else {
 		sort := page.SortBy
 		r.mapFields(sort)
@@ -286,20 +322,29 @@ func (r *MongoDAO[T, P]) MustGetPage(page *PageMeta, fields map[string]any) []P
 	if fields == nil {
 		fields = map[string]any{}
 	}
+	if textSearch {
+		// copy, fields might be shared between requests.
+		projection := make(map[string]any, len(fields)+1)
+		for k, v := range fields {
+			projection[k] = v
+		}
+		projection[TextScoreField] = TextScoreMeta()
+		fields = projection
+	}
 	// projection
 	opt.SetProjection(fields)
 
 	cursor, err := r.collection.Find(r.sessionContext, filter, opt)
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	data := make([]P, 0, cursor.RemainingBatchLength())
 	err = cursor.All(r.sessionContext, &data)
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	return data
@@ -341,14 +386,14 @@ func (r *MongoDAO[T, P]) get(filter map[string]any, opt *options.FindOneOptions)
 	}
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	var doc P
 	err = sr.Decode(&doc)
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	return doc
@@ -373,7 +418,7 @@ func (r *MongoDAO[T, P]) Exist(filter map[string]any) bool {
 	count, err := r.collection.CountDocuments(r.sessionContext, filter)
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	return count > 0
@@ -396,14 +441,14 @@ func (r *MongoDAO[T, P]) MustGetCommonFields(id any) *CommonFields {
 	}
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	var doc CommonFields
 	err = sr.Decode(&doc)
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	return &doc
@@ -419,7 +464,7 @@ func (r *MongoDAO[T, P]) MustAdd(doc P) {
 	_, err := r.collection.InsertOne(r.sessionContext, doc)
 
 	if err != nil {
-		panic(ErrMongoWriteError(err))
+		panic(r.writeError(err))
 	}
 }
 
@@ -441,7 +486,7 @@ func (r *MongoDAO[T, P]) MustAddMany(docs []P) {
 	_, err := r.collection.InsertMany(r.sessionContext, all)
 
 	if err != nil {
-		panic(ErrMongoWriteError(err))
+		panic(r.writeError(err))
 	}
 }
 
@@ -520,12 +565,35 @@ func (r *MongoDAO[T, P]) mustUpdate(filter, updates map[string]any, advancedUpda
 	}
 
 	if err != nil {
-		panic(ErrMongoWriteError(err))
+		panic(r.writeError(err))
 	}
 
 	return result.ModifiedCount
 }
 
+// Logger is CTX.Logger with field collection.
+func (r *MongoDAO[T, P]) Logger() *zap.Logger {
+	return r.CTX.Logger().With(zap.String("collection", r.collection.Name()))
+}
+
+// queryError logs err through Logger, and returns ErrMongoQueryError of err.
+func (r *MongoDAO[T, P]) queryError(err error) ErrorType {
+	return r.logError("mongo query failed", ErrMongoQueryError(err))
+}
+
+// writeError logs err through Logger, and returns ErrMongoWriteError of err.
+func (r *MongoDAO[T, P]) writeError(err error) ErrorType {
+	return r.logError("mongo write failed", ErrMongoWriteError(err))
+}
+
+func (r *MongoDAO[T, P]) logError(msg string, et ErrorType) ErrorType {
+	// e.g. canceled by the client
+	if et.Extra() != &notWorthLogging {
+		r.Logger().Error(msg, zap.Error(et))
+	}
+	return et
+}
+
 func (r *MongoDAO[T, P]) SessionContext() context.Context {
 	return r.sessionContext
 }
@@ -534,7 +602,7 @@ func (r *MongoDAO[T, P]) MustAggregate(pipeline []bson.M, customDecoding bool) (
 	cursor, err := r.collection.Aggregate(r.sessionContext, pipeline)
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	if customDecoding {
@@ -545,7 +613,7 @@ func (r *MongoDAO[T, P]) MustAggregate(pipeline []bson.M, customDecoding bool) (
 	err = cursor.All(r.sessionContext, &data)
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	return data, nil
@@ -557,7 +625,7 @@ func (r *MongoDAO[T, P]) MustDistinct(field string, filter bson.M) []any {
 	result, err := r.collection.Distinct(r.sessionContext, field, filter)
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	return result
@@ -588,7 +656,7 @@ func (r *MongoDAO[T, P]) MustSave(doc P) {
 	result, err := r.collection.ReplaceOne(r.sessionContext, bson.M{FieldID: id}, doc)
 
 	if err != nil {
-		panic(ErrMongoWriteError(err))
+		panic(r.writeError(err))
 	}
 
 	if result.MatchedCount == 0 {
@@ -633,7 +701,7 @@ func (r *MongoDAO[T, P]) mustSoftDelete(filter map[string]any, deleteAll bool) i
 	result, err := updateFunc(r.sessionContext, filter, up)
 
 	if err != nil {
-		panic(ErrMongoWriteError(err))
+		panic(r.writeError(err))
 	}
 
 	return result.ModifiedCount
@@ -663,7 +731,7 @@ func (r *MongoDAO[T, P]) mustHardDelete(filter map[string]any, deleteAll bool) i
 	result, err := deletionFunc(r.sessionContext, filter)
 
 	if err != nil {
-		panic(ErrMongoWriteError(err))
+		panic(r.writeError(err))
 	}
 
 	return result.DeletedCount
@@ -697,7 +765,11 @@ func (r *MongoDAO[T, P]) startTransaction() context.Context {
 		panic(ErrServerInternalError(fmt.Errorf("Failed to start a session. %v", err)))
 	}
 
-	r.sessionContext = mongo.NewSessionContext(context.Background(), session)
+	var parent context.Context = context.Background()
+	if r.CTX != nil {
+		parent = r.CTX
+	}
+	r.sessionContext = mongo.NewSessionContext(parent, session)
 
 	err = session.StartTransaction()
 
@@ -705,6 +777,8 @@ func (r *MongoDAO[T, P]) startTransaction() context.Context {
 		panic(ErrServerInternalError(err))
 	}
 
+	r.Logger().Debug("mongo transaction started")
+
 	return r.sessionContext
 }
 
@@ -714,15 +788,18 @@ func (r *MongoDAO[T, P]) commitTransaction() {
 		if err != nil {
 			panic(ErrMongoTransactionError(err))
 		}
+		r.Logger().Debug("mongo transaction committed")
 	}
 }
 
 func (r *MongoDAO[T, P]) abortTransaction() {
 	if sc, ok := r.sessionContext.(mongo.SessionContext); ok {
+		// not canceled with CTX, which might be done already.
 		err := sc.AbortTransaction(context.Background())
 		if err != nil {
 			panic(ErrMongoTransactionError(err))
 		}
+		r.Logger().Warn("mongo transaction aborted")
 	}
 }
 
@@ -743,7 +820,7 @@ func (r *MongoDAO[T, P]) MustAddJSON(json map[string]any) any {
 	result, err := r.collection.InsertOne(r.sessionContext, json)
 
 	if err != nil {
-		panic(ErrMongoWriteError(err))
+		panic(r.writeError(err))
 	}
 
 	return result.InsertedID
@@ -755,7 +832,7 @@ func (r *MongoDAO[T, P]) MustCount(page *PageMeta) int64 {
 	count, err := r.collection.CountDocuments(r.sessionContext, filter)
 
 	if err != nil {
-		panic(ErrMongoQueryError(err))
+		panic(r.queryError(err))
 	}
 
 	return count
@@ -0,0 +1,198 @@
+package xf
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.uber.org/zap"
+)
+
+// MongoSlowQueryOptions configures MongoSlowQueryMonitor.
+type MongoSlowQueryOptions struct {
+	// Slow and VerySlow thresholds. Default to SlowSQLDuration and VerySlowSQLDuration.
+	Slow     time.Duration
+	VerySlow time.Duration
+	// ExplainClient returns the client to explain very slow queries with. No explain if nil or returns nil.
+	// It's a function since the monitor is created before the client.
+	ExplainClient func() *mongo.Client
+	// ExplainTimeout defaults to 10 seconds.
+	ExplainTimeout time.Duration
+}
+
+// MaxLengthOfMongoFilterLog truncates filters in logs.
+var MaxLengthOfMongoFilterLog = 2 * 1024
+
+// mongoFilterKeys are fields of commands logged as filter, in order of preference.
+var mongoFilterKeys = []string{"filter", "query", "pipeline", "q", "updates", "deletes"}
+
+// mongoExplainableCommands can be explained by the explain command.
+var mongoExplainableCommands = map[string]bool{
+	"find": true, "aggregate": true, "count": true, "distinct": true,
+	"update": true, "delete": true, "findAndModify": true,
+}
+
+// mongoExplainExcludedKeys are session and transaction fields not accepted by explain.
+var mongoExplainExcludedKeys = map[string]bool{
+	"lsid": true, "txnNumber": true, "$clusterTime": true, "$db": true, "$readPreference": true,
+	"startTransaction": true, "autocommit": true, "readConcern": true, "writeConcern": true,
+}
+
+type mongoStartedCommand struct {
+	logger     *zap.Logger
+	database   string
+	collection string
+	filter     bson.RawValue
+	// command is kept only if it may be explained.
+	command bson.Raw
+}
+
+// MongoSlowQueryMonitor logs mongo commands with command name, collection, redacted filter, duration and tid of MongoDAO's CTX.
+// Commands are logged at debug level, tagged [SLOW] if slower than Slow, or logged at warn level and tagged [VERY SLOW]
+// if slower than VerySlow. Logs are of module "mongo", see SetModuleLogLevel.
+// Set it by options.Client().SetMonitor(xf.MongoCommandMonitors(xf.MongoSlowQueryMonitor(opts), ...)).
+func MongoSlowQueryMonitor(opts MongoSlowQueryOptions) *event.CommandMonitor {
+	var started sync.Map
+
+	slowThreshold := func() (slow, verySlow time.Duration) {
+		slow, verySlow = opts.Slow, opts.VerySlow
+		if slow <= 0 {
+			slow = SlowSQLDuration
+		}
+		if verySlow <= 0 {
+			verySlow = VerySlowSQLDuration
+		}
+		return
+	}
+
+	finish := func(e event.CommandFinishedEvent, failure string) {
+		v, ok := started.LoadAndDelete(mongoRequestKey{e.ConnectionID, e.RequestID})
+		if !ok {
+			return
+		}
+		cmd := v.(*mongoStartedCommand)
+		elapsed := time.Duration(e.DurationNanos)
+		slow, verySlow := slowThreshold()
+
+		fields := []zap.Field{
+			zap.String("command", e.CommandName),
+			zap.String("collection", cmd.collection),
+			zap.Float64("elapsed_ms", float64(elapsed.Nanoseconds())/1e6),
+		}
+		if filter := Redaction().MongoFilter(cmd.filter); filter != "" {
+			if len(filter) > MaxLengthOfMongoFilterLog {
+				filter = filter[:MaxLengthOfMongoFilterLog] + "..."
+			}
+			fields = append(fields, zap.String("filter", filter))
+		}
+		if failure != "" {
+			fields = append(fields, zap.String("failure", failure))
+		}
+
+		switch {
+		case elapsed >= verySlow:
+			cmd.logger.Warn("[VERY SLOW] mongo "+e.CommandName, fields...)
+			if cmd.command != nil {
+				go explainMongoCommand(opts, cmd, e.CommandName)
+			}
+		case failure != "":
+			cmd.logger.Warn("mongo "+e.CommandName, fields...)
+		case elapsed >= slow:
+			cmd.logger.Debug("[SLOW] mongo "+e.CommandName, fields...)
+		default:
+			cmd.logger.Debug("mongo "+e.CommandName, fields...)
+		}
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if e.CommandName == "explain" {
+				// issued by explainMongoCommand
+				return
+			}
+			cmd := &mongoStartedCommand{
+				logger:     mongoLoggerOf(ctx),
+				database:   e.DatabaseName,
+				collection: mongoCollectionOf(e),
+			}
+			for _, key := range mongoFilterKeys {
+				if v, err := e.Command.LookupErr(key); err == nil {
+					// the command is reused by the driver after the callback
+					cmd.filter = bson.RawValue{Type: v.Type, Value: append([]byte(nil), v.Value...)}
+					break
+				}
+			}
+			if opts.ExplainClient != nil && mongoExplainableCommands[e.CommandName] {
+				cmd.command = append(bson.Raw(nil), e.Command...)
+			}
+			started.Store(mongoRequestKey{e.ConnectionID, e.RequestID}, cmd)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finish(e.CommandFinishedEvent, "")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finish(e.CommandFinishedEvent, e.Failure)
+		},
+	}
+}
+
+// mongoLoggerOf returns logger of CTX in ctx, which is set by MongoDAO.
+func mongoLoggerOf(ctx context.Context) *zap.Logger {
+	if ctx != nil {
+		if c, ok := ctx.Value(ctxContextKey{}).(*CTX); ok {
+			return c.Logger().Named("mongo")
+		}
+	}
+	return ModuleLogger("mongo")
+}
+
+// explainMongoCommand logs the query plan of a very slow command.
+func explainMongoCommand(opts MongoSlowQueryOptions, cmd *mongoStartedCommand, commandName string) {
+	client := opts.ExplainClient()
+	if client == nil {
+		return
+	}
+
+	command := bson.D{}
+	elements, err := cmd.command.Elements()
+	if err != nil {
+		return
+	}
+	for _, elem := range elements {
+		if !mongoExplainExcludedKeys[elem.Key()] {
+			command = append(command, bson.E{Key: elem.Key(), Value: elem.Value()})
+		}
+	}
+
+	timeout := opts.ExplainTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var result bson.Raw
+	err = client.Database(cmd.database).RunCommand(ctx, bson.D{
+		{Key: "explain", Value: command},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}).Decode(&result)
+	if err != nil {
+		cmd.logger.Warn("failed to explain mongo "+commandName, zap.Error(err))
+		return
+	}
+
+	plan := result.Lookup("queryPlanner")
+	if len(plan.Value) == 0 {
+		// aggregate puts plans in stages
+		plan = bson.RawValue{Type: bson.TypeEmbeddedDocument, Value: result}
+	}
+	explain := Redaction().MongoFilter(plan)
+	if len(explain) > MaxLengthOfMongoFilterLog*4 {
+		explain = explain[:MaxLengthOfMongoFilterLog*4] + "..."
+	}
+	cmd.logger.Warn("[VERY SLOW] explain mongo "+commandName,
+		zap.String("collection", cmd.collection), zap.String("explain", explain))
+}
@@ -23,6 +23,9 @@ type PageMeta struct {
 	// 全文模糊搜索文本
 	SearchText string `json:"search_text,omitempty" form:"search_text" bson:"search_text"`
 
+	// 搜索模式，见SearchMode。不填使用服务的默认模式。
+	SearchMode SearchMode `json:"search_mode,omitempty" form:"search_mode" bson:"search_mode"`
+
 	// 总共（约）有多少条记录。仅作为返回值。
 	Total *int64 `json:"total,omitempty" form:"total" bson:"total"`
 }
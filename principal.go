@@ -0,0 +1,107 @@
+package xf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PrincipalKindUser    = "user"
+	PrincipalKindService = "service"
+)
+
+// Names of claims used by PrincipalFromClaims. Change them to fit your token issuer.
+var (
+	ClaimSubject     = "sub"
+	ClaimTenant      = "tenant"
+	ClaimRoles       = "roles"
+	ClaimPermissions = "permissions"
+	ClaimScope       = "scope"
+)
+
+// Principal is the verified caller of a request.
+// xf doesn't verify JWT signature. Set principal after verification by SetVerifiedClaims or CTX.SetPrincipal.
+type Principal struct {
+	// ID is the subject, e.g. user id or service name.
+	ID string
+	// Kind is PrincipalKindUser or PrincipalKindService.
+	Kind        string
+	Tenant      string
+	Roles       []string
+	Permissions []string
+	// Claims are all verified claims.
+	Claims map[string]any
+}
+
+// PrincipalFromClaims creates a user principal from verified JWT claims.
+// Permissions are read from ClaimPermissions, and space separated ClaimScope.
+func PrincipalFromClaims(claims map[string]any) *Principal {
+	p := &Principal{
+		Kind:   PrincipalKindUser,
+		Claims: claims,
+	}
+
+	if v, ok := claims[ClaimSubject]; ok && v != nil {
+		p.ID = fmt.Sprintf("%v", v)
+	}
+	if v, ok := claims[ClaimTenant]; ok && v != nil {
+		p.Tenant = fmt.Sprintf("%v", v)
+	}
+	p.Roles = stringsOfClaim(claims[ClaimRoles])
+	p.Permissions = stringsOfClaim(claims[ClaimPermissions])
+	p.Permissions = append(p.Permissions, stringsOfClaim(claims[ClaimScope])...)
+
+	return p
+}
+
+func stringsOfClaim(v any) []string {
+	switch v.(type) {
+	case nil:
+		return nil
+	case string:
+		return strings.Fields(v.(string))
+	case []string:
+		return v.([]string)
+	case []any:
+		a := v.([]any)
+		s := make([]string, 0, len(a))
+		for _, e := range a {
+			s = append(s, fmt.Sprintf("%v", e))
+		}
+		return s
+	}
+	return []string{fmt.Sprintf("%v", v)}
+}
+
+// HasRole returns true if principal has the role.
+func (r *Principal) HasRole(role string) bool {
+	if r == nil {
+		return false
+	}
+	for _, e := range r.Roles {
+		if e == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission returns true if principal has the permission.
+func (r *Principal) HasPermission(permission string) bool {
+	if r == nil {
+		return false
+	}
+	for _, e := range r.Permissions {
+		if e == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// SetVerifiedClaims sets principal of the request from claims which have been verified by caller.
+func SetVerifiedClaims(c *gin.Context, claims map[string]any) {
+	getCTX(c).SetPrincipal(PrincipalFromClaims(claims))
+}
@@ -0,0 +1,152 @@
+package xf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// ErrorResponseMode decides the body of error responses.
+type ErrorResponseMode int
+
+const (
+	// ErrorResponseModeDefault responds {"error": {"code", "desc", "tid"}}.
+	ErrorResponseModeDefault ErrorResponseMode = iota
+	// ErrorResponseModeProblem responds application/problem+json defined by RFC 7807.
+	ErrorResponseModeProblem
+)
+
+// DefaultErrorResponseMode is used by routes without ErrorResponseModeMiddleware.
+var DefaultErrorResponseMode = ErrorResponseModeDefault
+
+// ProblemTypeBaseURI prefixes error code to create "type" of problem details, e.g. "https://api.example.com/errors/".
+// If empty, "about:blank" is used, and "title" is the http status text.
+var ProblemTypeBaseURI = ""
+
+const ProblemJSONContentType = "application/problem+json"
+
+const errorResponseModeKey = "xf_error_response_mode"
+
+// ErrorResponseModeMiddleware selects error response mode of a route group.
+func ErrorResponseModeMiddleware(mode ErrorResponseMode) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(errorResponseModeKey, mode)
+		c.Next()
+	}
+}
+
+// ProblemDetailsMiddleware is short for ErrorResponseModeMiddleware(ErrorResponseModeProblem).
+func ProblemDetailsMiddleware() gin.HandlerFunc {
+	return ErrorResponseModeMiddleware(ErrorResponseModeProblem)
+}
+
+func errorResponseModeOf(c *gin.Context) ErrorResponseMode {
+	if v, ok := c.Get(errorResponseModeKey); ok {
+		if mode, ok := v.(ErrorResponseMode); ok {
+			return mode
+		}
+	}
+	return DefaultErrorResponseMode
+}
+
+// ProblemDetails is the error body defined by RFC 7807, with extension members code, tid and errors.
+type ProblemDetails struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     any          `json:"code,omitempty"`
+	TID      string       `json:"tid,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes an invalid field of request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// FieldErrors is an error of invalid fields. Wrap it in an ErrorType to respond field errors.
+type FieldErrors []FieldError
+
+func (r FieldErrors) Error() string {
+	s := make([]string, 0, len(r))
+	for _, e := range r {
+		s = append(s, e.Field+": "+e.Message)
+	}
+	return strings.Join(s, "; ")
+}
+
+// ErrInvalidFields responds 400 with field errors.
+func ErrInvalidFields(fieldErrors ...FieldError) ErrorType {
+	return ErrDefInvalidParameters.New(FieldErrors(fieldErrors))
+}
+
+// FieldErrorsOf extracts field errors from err. Supports FieldErrors and validator.ValidationErrors in the chain.
+func FieldErrorsOf(err error) []FieldError {
+	var fe FieldErrors
+	if errors.As(err, &fe) {
+		return fe
+	}
+
+	var ve validator.ValidationErrors
+	if errors.As(err, &ve) {
+		fieldErrors := make([]FieldError, 0, len(ve))
+		for _, e := range ve {
+			fieldErrors = append(fieldErrors, FieldError{
+				Field:   e.Field(),
+				Message: fmt.Sprintf("failed on the '%s' tag", e.Tag()),
+			})
+		}
+		return fieldErrors
+	}
+
+	return nil
+}
+
+// NewProblemDetails creates problem details of et. detail is the (localized) description of et.
+func NewProblemDetails(et ErrorType, detail, instance, traceID string) *ProblemDetails {
+	p := &ProblemDetails{
+		Type:     "about:blank",
+		Title:    http.StatusText(et.StatusCode()),
+		Status:   et.StatusCode(),
+		Detail:   detail,
+		Instance: instance,
+		Code:     et.ErrorCode(),
+		TID:      traceID,
+		Errors:   FieldErrorsOf(et),
+	}
+
+	// with about:blank, title must be the http status text. See RFC 7807 section 4.2.
+	if ProblemTypeBaseURI != "" {
+		p.Type = ProblemTypeBaseURI + url.PathEscape(fmt.Sprintf("%v", et.ErrorCode()))
+		p.Title = fmt.Sprintf("%v", et.ErrorCode())
+		if def := LookupError(et.ErrorCode()); def != nil {
+			p.Type = def.ProblemType()
+			if def.Description != "" {
+				p.Title = def.Description
+			}
+		}
+	}
+
+	if p.Title == "" {
+		p.Title = fmt.Sprintf("%v", et.ErrorCode())
+	}
+
+	return p
+}
+
+func respondProblem(c *gin.Context, status int, p *ProblemDetails) {
+	bytes, err := json.Marshal(p)
+	if err != nil {
+		panic(ErrMarshalJSONError(err))
+	}
+	c.Data(status, ProblemJSONContentType, bytes)
+}
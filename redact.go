@@ -0,0 +1,517 @@
+package xf
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RedactedMask replaces sensitive values by default.
+const RedactedMask = "******"
+
+// RedactionConfig defines what should be masked in request dumps and SQL traces.
+type RedactionConfig struct {
+	// Disabled turns redaction off. Useful in local debugging only.
+	Disabled bool
+
+	// Mask replaces sensitive values. Default is RedactedMask.
+	Mask string
+
+	// Headers are http header names whose values are masked. Case-insensitive.
+	Headers []string
+
+	// Fields are JSON or form keys whose values are masked in request bodies. Case-insensitive.
+	// Fields tagged with xf:"sensitive" are added by ParseXFTag or RegisterSensitiveFields.
+	Fields []string
+
+	// SQLColumns are columns whose bound arguments are masked in SQLTrace. Case-insensitive.
+	SQLColumns []string
+}
+
+// DefaultRedactionConfig masks Authorization and Cookie headers, and some common credential fields.
+func DefaultRedactionConfig() RedactionConfig {
+	return RedactionConfig{
+		Mask:       RedactedMask,
+		Headers:    []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"},
+		Fields:     []string{"password", "passwd", "secret", "token", "access_token", "refresh_token"},
+		SQLColumns: []string{"password", "passwd", "secret", "token"},
+	}
+}
+
+// Redactor masks sensitive data before it is written to log. It's safe for concurrent use.
+type Redactor struct {
+	lock       sync.RWMutex
+	disabled   bool
+	mask       string
+	headers    map[string]struct{}
+	fields     map[string]struct{}
+	sqlColumns map[string]struct{}
+
+	// registered by xf:"sensitive" tags. Kept by ConfigRedaction.
+	sensitiveFields  map[string]struct{}
+	sensitiveColumns map[string]struct{}
+
+	// compiled from fields
+	jsonRegex *regexp.Regexp
+	formRegex *regexp.Regexp
+}
+
+func NewRedactor(config RedactionConfig) *Redactor {
+	r := &Redactor{
+		disabled:   config.Disabled,
+		mask:       config.Mask,
+		headers:    map[string]struct{}{},
+		fields:     map[string]struct{}{},
+		sqlColumns: map[string]struct{}{},
+	}
+	if r.mask == "" {
+		r.mask = RedactedMask
+	}
+	r.AddHeaders(config.Headers...)
+	r.AddFields(config.Fields...)
+	r.AddSQLColumns(config.SQLColumns...)
+	return r
+}
+
+var redactor = func() *atomic.Pointer[Redactor] {
+	p := &atomic.Pointer[Redactor]{}
+	p.Store(NewRedactor(DefaultRedactionConfig()))
+	return p
+}()
+
+// redactorLock serializes ConfigRedaction and registering xf:"sensitive" fields, so that none is lost.
+var redactorLock sync.Mutex
+
+// Redaction returns the redactor used by respondError, LoggerWithConfig and SQLTrace.
+func Redaction() *Redactor {
+	return redactor.Load()
+}
+
+// ConfigRedaction replaces the global redactor. Fields registered by xf:"sensitive" tags are kept.
+func ConfigRedaction(config RedactionConfig) {
+	redactorLock.Lock()
+	defer redactorLock.Unlock()
+
+	r := NewRedactor(config)
+	old := redactor.Load()
+	old.lock.RLock()
+	for f := range old.sensitiveFields {
+		r.addFields(true, f)
+	}
+	for c := range old.sensitiveColumns {
+		r.addSQLColumns(true, c)
+	}
+	old.lock.RUnlock()
+	redactor.Store(r)
+}
+
+// AddHeaders adds header names to be masked.
+func (r *Redactor) AddHeaders(names ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, name := range names {
+		r.headers[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+}
+
+// AddFields adds JSON or form keys to be masked.
+func (r *Redactor) AddFields(names ...string) {
+	r.addFields(false, names...)
+}
+
+func (r *Redactor) addFields(tagged bool, names ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, name := range names {
+		if name == "" || name == "-" {
+			continue
+		}
+		name = strings.ToLower(name)
+		r.fields[name] = struct{}{}
+		if tagged {
+			if r.sensitiveFields == nil {
+				r.sensitiveFields = map[string]struct{}{}
+			}
+			r.sensitiveFields[name] = struct{}{}
+		}
+	}
+	r.compile()
+}
+
+// AddSQLColumns adds columns whose bound arguments are masked.
+func (r *Redactor) AddSQLColumns(names ...string) {
+	r.addSQLColumns(false, names...)
+}
+
+func (r *Redactor) addSQLColumns(tagged bool, names ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, name := range names {
+		if name == "" || name == "-" {
+			continue
+		}
+		name = strings.ToLower(name)
+		r.sqlColumns[name] = struct{}{}
+		if tagged {
+			if r.sensitiveColumns == nil {
+				r.sensitiveColumns = map[string]struct{}{}
+			}
+			r.sensitiveColumns[name] = struct{}{}
+		}
+	}
+}
+
+// compile builds regular expressions from fields. Caller must hold the write lock.
+func (r *Redactor) compile() {
+	if len(r.fields) == 0 {
+		r.jsonRegex = nil
+		r.formRegex = nil
+		return
+	}
+
+	names := make([]string, 0, len(r.fields))
+	for f := range r.fields {
+		names = append(names, regexp.QuoteMeta(f))
+	}
+	sort.Strings(names)
+	alt := strings.Join(names, "|")
+
+	// "key": "value" | "key": 123 | "key": true | "key": [flat array] | "key": {flat object}. Works with truncated JSON too.
+	// Nested values are not fully matched, see MongoFilter for documents.
+	r.jsonRegex = regexp.MustCompile(`(?i)("(?:` + alt + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|\[[^\[\]{}]*\]?|\{[^{}]*\}?|[^,}\]\s]+)`)
+	// key=value&
+	r.formRegex = regexp.MustCompile(`(?i)((?:^|&)(?:` + alt + `)=)([^&]*)`)
+}
+
+// Mask returns the mask string.
+func (r *Redactor) Mask() string {
+	if r == nil {
+		return RedactedMask
+	}
+	return r.mask
+}
+
+// IsSensitiveHeader returns true if value of the header should be masked.
+func (r *Redactor) IsSensitiveHeader(name string) bool {
+	if r == nil || r.disabled {
+		return false
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	_, ok := r.headers[http.CanonicalHeaderKey(name)]
+	return ok
+}
+
+// IsSensitiveField returns true if value of the JSON or form key should be masked.
+func (r *Redactor) IsSensitiveField(name string) bool {
+	if r == nil || r.disabled {
+		return false
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	_, ok := r.fields[strings.ToLower(name)]
+	return ok
+}
+
+// IsSensitiveSQLColumn returns true if arguments bound to the column should be masked.
+func (r *Redactor) IsSensitiveSQLColumn(name string) bool {
+	if r == nil || r.disabled {
+		return false
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	_, ok := r.sqlColumns[strings.ToLower(name)]
+	return ok
+}
+
+// HeaderLines returns "Key: value" lines of headers with sensitive values masked.
+func (r *Redactor) HeaderLines(header http.Header) []string {
+	lines := make([]string, 0, len(header))
+	for k, vs := range header {
+		sensitive := r.IsSensitiveHeader(k)
+		for _, v := range vs {
+			if sensitive {
+				v = r.Mask()
+			}
+			lines = append(lines, k+": "+v)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// Body masks sensitive fields in a JSON or form-urlencoded body. Other content is returned as it is.
+func (r *Redactor) Body(contentType string, body []byte) []byte {
+	if r == nil || r.disabled || len(body) == 0 {
+		return body
+	}
+
+	r.lock.RLock()
+	jsonRegex, formRegex := r.jsonRegex, r.formRegex
+	r.lock.RUnlock()
+
+	if jsonRegex == nil {
+		return body
+	}
+
+	mask := strings.ReplaceAll(r.mask, "$", "$$")
+
+	if strings.Contains(contentType, "x-www-form-urlencoded") {
+		return formRegex.ReplaceAll(body, []byte("${1}"+mask))
+	}
+
+	return jsonRegex.ReplaceAll(body, []byte(`${1}"`+mask+`"`))
+}
+
+// MongoFilter returns filter (a document or an array like pipeline) as relaxed extended JSON, in which values of
+// sensitive fields are masked as a whole, e.g. {"phone": {"$in": [...]}}. Keys are matched by the last part of dotted paths.
+func (r *Redactor) MongoFilter(filter bson.RawValue) string {
+	if len(filter.Value) == 0 {
+		return ""
+	}
+	// arrays can't be marshaled at top level
+	j, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: r.mongoValue(filter, 0)}}, false, false)
+	if err != nil {
+		return r.Mask()
+	}
+	j = bytes.TrimSuffix(bytes.TrimPrefix(j, []byte(`{"v":`)), []byte("}"))
+	return string(j)
+}
+
+// maxMongoRedactionDepth bounds recursion of mongoValue. Deeper values are masked.
+const maxMongoRedactionDepth = 32
+
+// mongoValue returns v with values of sensitive keys masked. Documents become bson.D, arrays bson.A,
+// and other values are kept as they are.
+func (r *Redactor) mongoValue(v bson.RawValue, depth int) any {
+	if depth > maxMongoRedactionDepth {
+		return r.Mask()
+	}
+
+	switch v.Type {
+	case bson.TypeEmbeddedDocument:
+		elements, err := v.Document().Elements()
+		if err != nil {
+			return r.Mask()
+		}
+		d := make(bson.D, 0, len(elements))
+		for _, e := range elements {
+			key := e.Key()
+			if r.isSensitiveMongoKey(key) {
+				d = append(d, bson.E{Key: key, Value: r.Mask()})
+			} else {
+				d = append(d, bson.E{Key: key, Value: r.mongoValue(e.Value(), depth+1)})
+			}
+		}
+		return d
+	case bson.TypeArray:
+		values, err := v.Array().Values()
+		if err != nil {
+			return r.Mask()
+		}
+		a := make(bson.A, 0, len(values))
+		for _, e := range values {
+			a = append(a, r.mongoValue(e, depth+1))
+		}
+		return a
+	}
+	return v
+}
+
+func (r *Redactor) isSensitiveMongoKey(key string) bool {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		key = key[i+1:]
+	}
+	return r.IsSensitiveField(key)
+}
+
+// RawRequest masks sensitive headers and body fields in a raw http request, which might be truncated.
+func (r *Redactor) RawRequest(raw []byte) []byte {
+	if r == nil || r.disabled || len(raw) == 0 {
+		return raw
+	}
+
+	head, body := raw, []byte(nil)
+	sep := []byte("\r\n\r\n")
+	if i := bytes.Index(raw, sep); i >= 0 {
+		head, body = raw[:i], raw[i+len(sep):]
+	}
+
+	var contentType string
+	lines := bytes.Split(head, []byte("\r\n"))
+	for i, line := range lines {
+		if i == 0 {
+			// request line
+			continue
+		}
+		colon := bytes.IndexByte(line, ':')
+		if colon <= 0 {
+			continue
+		}
+		name := string(line[:colon])
+		if strings.EqualFold(name, "Content-Type") {
+			contentType = strings.TrimSpace(string(line[colon+1:]))
+		}
+		if r.IsSensitiveHeader(name) {
+			lines[i] = []byte(name + ": " + r.Mask())
+		}
+	}
+
+	out := bytes.Join(lines, []byte("\r\n"))
+	if body != nil {
+		out = append(out, sep...)
+		out = append(out, r.Body(contentType, body)...)
+	}
+	return out
+}
+
+// SQLArgs returns a copy of args in which arguments bound to sensitive columns are masked.
+// Columns are recognized from "column = ?" like comparisons, "column IN (?, ?)"
+// and "INSERT INTO table (columns) VALUES (?, ?)".
+func (r *Redactor) SQLArgs(query string, args []any) []any {
+	if r == nil || r.disabled || len(args) == 0 {
+		return args
+	}
+
+	r.lock.RLock()
+	empty := len(r.sqlColumns) == 0
+	r.lock.RUnlock()
+
+	if empty {
+		return args
+	}
+
+	columns := sqlPlaceholderColumns(query)
+
+	var redacted []any
+	for i, column := range columns {
+		if i >= len(args) {
+			break
+		}
+		if column != "" && r.IsSensitiveSQLColumn(column) {
+			if redacted == nil {
+				redacted = make([]any, len(args))
+				copy(redacted, args)
+			}
+			redacted[i] = r.mask
+		}
+	}
+
+	if redacted == nil {
+		return args
+	}
+	return redacted
+}
+
+var sqlInsertRegex = regexp.MustCompile(`(?is)^\s*(?:insert|replace)\s+(?:ignore\s+)?(?:into\s+)?[^\s(]+\s*\(([^)]*)\)\s*values?\s*(.*)$`)
+var sqlColumnBeforePlaceholderRegex = regexp.MustCompile(`(?i)([\w.` + "`" + `"]+)\s*(?:=|<>|!=|<=|>=|<|>|\s+like|\s+not\s+like|\s+in\s*\((?:\s*\?\s*,)*)\s*$`)
+
+// sqlPlaceholderColumns returns the column name of each '?' placeholder in query. Unknown columns are "".
+func sqlPlaceholderColumns(query string) []string {
+	var columns []string
+
+	if m := sqlInsertRegex.FindStringSubmatch(query); m != nil {
+		names := strings.Split(m[1], ",")
+		for i := range names {
+			names[i] = trimSQLName(names[i])
+		}
+		n := strings.Count(m[2], "?")
+		for i := 0; i < n; i++ {
+			columns = append(columns, names[i%len(names)])
+		}
+		// placeholders after VALUES, e.g. ON DUPLICATE KEY UPDATE are rare. Ignore them.
+		return columns
+	}
+
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			continue
+		}
+		column := ""
+		if m := sqlColumnBeforePlaceholderRegex.FindStringSubmatch(query[:i]); m != nil {
+			column = trimSQLName(m[1])
+		}
+		columns = append(columns, column)
+	}
+
+	return columns
+}
+
+func trimSQLName(name string) string {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.Trim(name, "`\" ")
+}
+
+// RegisterSensitiveFields registers fields tagged with xf:"sensitive" of the struct types of objs.
+// Models parsed by ParseXFTag are registered automatically.
+func RegisterSensitiveFields(objs ...any) {
+	for _, obj := range objs {
+		t := reflect.TypeOf(obj)
+		for t != nil && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t == nil || t.Kind() != reflect.Struct {
+			continue
+		}
+		registerSensitiveFieldsOfType(t)
+	}
+}
+
+func registerSensitiveFieldsOfType(t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous {
+			tt := field.Type
+			for tt.Kind() == reflect.Ptr {
+				tt = tt.Elem()
+			}
+			if tt.Kind() == reflect.Struct {
+				registerSensitiveFieldsOfType(tt)
+			}
+			continue
+		}
+		for _, opt := range strings.Split(field.Tag.Get("xf"), ",") {
+			if opt == "sensitive" {
+				registerSensitiveField(field)
+			}
+		}
+	}
+}
+
+// registerSensitiveField registers JSON name and column names of field to the global redactor.
+func registerSensitiveField(field reflect.StructField) {
+	names := []string{field.Name}
+	if n := fieldNameFromTag("json", field.Tag.Get("json")); n != "" {
+		names = append(names, n)
+	}
+	redactorLock.Lock()
+	defer redactorLock.Unlock()
+
+	r := redactor.Load()
+	r.addFields(true, names...)
+
+	columns := []string{field.Name}
+	if n := fieldNameFromTag("bson", field.Tag.Get("bson")); n != "" {
+		columns = append(columns, n)
+	}
+	if n := fieldNameFromTag("gorm", field.Tag.Get("gorm")); n != "" {
+		columns = append(columns, n)
+	}
+	if n := strings.Split(field.Tag.Get("db"), ",")[0]; n != "" {
+		columns = append(columns, n)
+	}
+	r.addSQLColumns(true, columns...)
+}
@@ -0,0 +1,124 @@
+package xf
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func newTestRedactor() *Redactor {
+	config := DefaultRedactionConfig()
+	config.Fields = append(config.Fields, "phone")
+	config.SQLColumns = append(config.SQLColumns, "phone")
+	return NewRedactor(config)
+}
+
+func TestRedactorBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expected    string
+	}{
+		{"json string", "application/json", `{"user":"a","password":"p@ss"}`, `{"user":"a","password":"******"}`},
+		{"json case insensitive", "application/json", `{"Password" : "p"}`, `{"Password" : "******"}`},
+		{"json escaped quote", "application/json", `{"token":"a\"b","x":1}`, `{"token":"******","x":1}`},
+		{"json number", "application/json", `{"phone":13812341234}`, `{"phone":"******"}`},
+		{"json array", "application/json", `{"phone":["138","139"],"x":1}`, `{"phone":"******","x":1}`},
+		{"json object", "application/json", `{"phone":{"home":"138"},"x":1}`, `{"phone":"******","x":1}`},
+		{"json truncated", "application/json", `{"password":"p@s`, `{"password":"******"`},
+		{"json other keys", "application/json", `{"passwords_hint":"x"}`, `{"passwords_hint":"x"}`},
+		{"form", "application/x-www-form-urlencoded", `user=a&password=p&token=t`, `user=a&password=******&token=******`},
+		{"text", "text/plain", `password=p`, `password=p`},
+	}
+
+	r := newTestRedactor()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(r.Body(tt.contentType, []byte(tt.body))); got != tt.expected {
+				t.Fatalf("got %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRedactorDisabled(t *testing.T) {
+	r := NewRedactor(RedactionConfig{Disabled: true, Fields: []string{"password"}})
+	if got := string(r.Body("application/json", []byte(`{"password":"p"}`))); got != `{"password":"p"}` {
+		t.Fatal(got)
+	}
+}
+
+func TestRedactorHeaderLines(t *testing.T) {
+	h := http.Header{}
+	h.Set("Authorization", "Bearer x")
+	h.Set("Accept", "*/*")
+	got := strings.Join(newTestRedactor().HeaderLines(h), "\n")
+	if got != "Accept: */*\nAuthorization: ******" {
+		t.Fatal(got)
+	}
+}
+
+func TestRedactorSQLArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		args     []any
+		expected []any
+	}{
+		{"where", "SELECT * FROM u WHERE name = ? AND password = ?", []any{"a", "p"}, []any{"a", "******"}},
+		{"qualified", "SELECT * FROM u WHERE u.`phone` <> ?", []any{"138"}, []any{"******"}},
+		{"in", "SELECT * FROM u WHERE phone IN (?, ?) AND id = ?", []any{"1", "2", 3}, []any{"******", "******", 3}},
+		{"like", "SELECT * FROM u WHERE token LIKE ?", []any{"t%"}, []any{"******"}},
+		{"insert", "INSERT INTO u (name, password) VALUES (?, ?), (?, ?)", []any{"a", "p", "b", "q"}, []any{"a", "******", "b", "******"}},
+		{"nothing sensitive", "SELECT * FROM u WHERE id = ?", []any{1}, []any{1}},
+	}
+
+	r := newTestRedactor()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.SQLArgs(tt.query, tt.args)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("got %v, want %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Fatalf("got %v, want %v", got, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestRedactorMongoFilter(t *testing.T) {
+	rawValue := func(v any) bson.RawValue {
+		doc, err := bson.Marshal(bson.D{{Key: "v", Value: v}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bson.Raw(doc).Lookup("v")
+	}
+
+	tests := []struct {
+		name     string
+		filter   any
+		expected string
+	}{
+		{"plain", bson.D{{Key: "phone", Value: "138"}, {Key: "age", Value: 3}}, `{"phone":"******","age":3}`},
+		{"in", bson.D{{Key: "phone", Value: bson.D{{Key: "$in", Value: bson.A{"a", "b"}}}}}, `{"phone":"******"}`},
+		{"or", bson.D{{Key: "$or", Value: bson.A{bson.D{{Key: "phone", Value: "a"}}, bson.D{{Key: "name", Value: "b"}}}}}, `{"$or":[{"phone":"******"},{"name":"b"}]}`},
+		{"dotted", bson.D{{Key: "contact.phone", Value: "a"}}, `{"contact.phone":"******"}`},
+		{"pipeline", bson.A{bson.D{{Key: "$match", Value: bson.D{{Key: "password", Value: "p"}}}}}, `[{"$match":{"password":"******"}}]`},
+	}
+
+	r := newTestRedactor()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.MongoFilter(rawValue(tt.filter)); got != tt.expected {
+				t.Fatalf("got %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
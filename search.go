@@ -0,0 +1,143 @@
+package xf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SearchMode 关键字搜索模式
+type SearchMode string
+
+const (
+	// SearchModeContains 转义后的包含匹配，不区分大小写。默认模式。
+	SearchModeContains SearchMode = "contains"
+	// SearchModePrefix 转义后的前缀匹配，不区分大小写。
+	SearchModePrefix SearchMode = "prefix"
+	// SearchModeTokens 按空白分词，每个词都必须命中（任一搜索字段），不区分大小写。
+	SearchModeTokens SearchMode = "tokens"
+	// SearchModeText 使用Mongo文本索引（$text）搜索，按相关度排序。字段需要标记 xf:"search:text"。
+	SearchModeText SearchMode = "text"
+)
+
+// DefaultSearchMode is used when neither PageMeta nor CommonSvc specifies a search mode.
+var DefaultSearchMode = SearchModeContains
+
+// MaxSearchTextLength 搜索关键字的最大长度（字符数），超出部分将被截断。
+var MaxSearchTextLength = 64
+
+// MaxSearchTokens 分词搜索时最多使用的词数，超出部分将被忽略。
+var MaxSearchTokens = 8
+
+// TextScoreField is the name of the projected field holding text search score.
+const TextScoreField = "_text_score"
+
+// IsValid returns true if r is one of the predefined search modes.
+func (r SearchMode) IsValid() bool {
+	switch r {
+	case SearchModeContains, SearchModePrefix, SearchModeTokens, SearchModeText:
+		return true
+	}
+	return false
+}
+
+// orDefault returns DefaultSearchMode if r is empty.
+func (r SearchMode) orDefault() SearchMode {
+	if r == "" {
+		return DefaultSearchMode
+	}
+	return r
+}
+
+// TruncateSearchText trims spaces and limits the length of text to MaxSearchTextLength.
+func TruncateSearchText(text string) string {
+	text = strings.TrimSpace(text)
+	runes := []rune(text)
+	if MaxSearchTextLength > 0 && len(runes) > MaxSearchTextLength {
+		text = strings.TrimSpace(string(runes[:MaxSearchTextLength]))
+	}
+	return text
+}
+
+// searchTokens splits text by white spaces. The number of tokens is limited to MaxSearchTokens.
+func searchTokens(text string) []string {
+	tokens := strings.Fields(TruncateSearchText(text))
+	if MaxSearchTokens > 0 && len(tokens) > MaxSearchTokens {
+		tokens = tokens[:MaxSearchTokens]
+	}
+	return tokens
+}
+
+// SearchRegex returns a case-insensitive regex matching keyword literally.
+// Special characters in keyword are escaped, so user input can never be interpreted as a regular expression.
+func SearchRegex(mode SearchMode, keyword string) primitive.Regex {
+	pattern := regexp.QuoteMeta(keyword)
+	if mode == SearchModePrefix {
+		pattern = "^" + pattern
+	}
+	return primitive.Regex{Pattern: pattern, Options: "i"}
+}
+
+// SearchCondition returns the mongo condition of a field to match keyword with mode.
+// SearchModeText is not a field level condition, SearchModeContains is applied instead.
+func SearchCondition(mode SearchMode, keyword any) any {
+	text := fmt.Sprintf("%v", keyword)
+
+	if mode.orDefault() == SearchModeTokens {
+		tokens := searchTokens(text)
+		if len(tokens) > 1 {
+			all := make(bson.A, 0, len(tokens))
+			for _, token := range tokens {
+				all = append(all, SearchRegex(mode, token))
+			}
+			return bson.M{"$all": all}
+		}
+		text = strings.Join(tokens, "")
+	} else {
+		text = TruncateSearchText(text)
+	}
+
+	return SearchRegex(mode.orDefault(), text)
+}
+
+// searchAcrossFields returns conditions which require every token to be found in at least one of the fields.
+func searchAcrossFields(mode SearchMode, fields map[string]any) bson.A {
+	// all fields share the same keyword when built by CommonSvc. Tokenize each keyword separately otherwise.
+	byToken := map[string][]string{}
+	tokens := make([]string, 0)
+	for field, keyword := range fields {
+		for _, token := range searchTokens(fmt.Sprintf("%v", keyword)) {
+			if _, ok := byToken[token]; !ok {
+				tokens = append(tokens, token)
+			}
+			byToken[token] = append(byToken[token], field)
+		}
+	}
+
+	and := make(bson.A, 0, len(tokens))
+	for _, token := range tokens {
+		or := make(bson.A, 0, len(byToken[token]))
+		for _, field := range byToken[token] {
+			or = append(or, bson.M{field: SearchRegex(mode, token)})
+		}
+		and = append(and, bson.M{"$or": or})
+	}
+	return and
+}
+
+// TextSearchFilter returns a $text filter. Returns nil if text is empty.
+func TextSearchFilter(text string) bson.M {
+	text = TruncateSearchText(text)
+	if text == "" {
+		return nil
+	}
+	return bson.M{"$search": text}
+}
+
+// TextScoreMeta is used for projecting and sorting by text search score.
+func TextScoreMeta() bson.M {
+	return bson.M{"$meta": "textScore"}
+}
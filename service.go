@@ -3,7 +3,6 @@ package xf
 import (
 	"go.mongodb.org/mongo-driver/bson"
 	"reflect"
-	"strings"
 )
 
 type CommonSvc[T any, P CommonModel[T]] struct {
@@ -20,12 +19,24 @@ type CommonSvc[T any, P CommonModel[T]] struct {
 	ModFields map[string]struct{}
 	// 通过关键字搜索时，要查哪些字段名。
 	KeywordToFields []string
+	// 建有文本索引的字段（xf:"search:text"），非空时才允许使用SearchModeText。
+	TextSearchFields []string
+	// 默认的关键字搜索模式，不填使用DefaultSearchMode。
+	SearchMode SearchMode
 	// 通用代码不会查询这些字段
 	HiddenFields []string
 	// false，标记删除；true，物理删除；
 	HardDeletion bool
 	// 是否允许修改或删除多个记录。
 	AllowsModMany bool
+	// 查看标记了 xf:"mask:xxx" 的字段完整值所需的权限，不填使用DefaultUnmaskPermission。
+	UnmaskPermission string
+}
+
+// MaskOutput 对输出数据中标记了 xf:"mask:xxx" 的字段打码，除非调用者有UnmaskPermission权限。
+// 原地修改，只能在输出前调用（API和GRPCCRUD已调用），打码后的对象不能再保存。
+func (r *CommonSvc[T, P]) MaskOutput(v any) {
+	MaskOutput(r.CTX, r.UnmaskPermission, v)
 }
 
 func (r *CommonSvc[T, P]) PrepareGet(filter map[string]any) {
@@ -39,12 +50,24 @@ func (r *CommonSvc[T, P]) MustGet(filter map[string]any) P {
 }
 
 func (r *CommonSvc[T, P]) fixSearchParameters(page *PageMeta) {
-	if len(r.KeywordToFields) == 0 {
-		return
+	text := TruncateSearchText(page.SearchText)
+	page.SearchText = text
+
+	mode := page.SearchMode
+	if mode == "" {
+		mode = r.SearchMode.orDefault()
 	}
 
-	text := strings.TrimSpace(page.SearchText)
-	if text == "" {
+	// 只有搜索内容，且有可搜索的字段时，才检查search_mode。
+	searchable := len(r.KeywordToFields) > 0 || len(r.TextSearchFields) > 0
+	if text != "" && searchable && (!mode.IsValid() || (mode == SearchModeText && len(r.TextSearchFields) == 0)) {
+		panic(ErrInvalidParameters("search_mode"))
+	}
+
+	page.SearchMode = mode
+
+	// $text is built by DAO from SearchText.
+	if mode == SearchModeText || len(r.KeywordToFields) == 0 || text == "" {
 		return
 	}
 
@@ -0,0 +1,534 @@
+package xf
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Authorization schemes of service-to-service authentication.
+//
+//	Authorization: XF-APIKEY <keyID>:<secret>
+//	Authorization: XF-HMAC-SHA256 keyId=<keyID>,ts=<unix seconds>,nonce=<nonce>,signature=<base64>
+//
+// HMAC string to sign of http request is "METHOD\nREQUEST_URI\nts\nnonce\nhex(sha256(body))".
+// HMAC string to sign of grpc unary call is "full method\nts\nnonce\nhex(sha256(message))", where message is
+// the request marshalled deterministically by protobuf. Messages of streams are not signed, so streams are
+// authenticated but not tamper-proof.
+const (
+	AuthSchemeAPIKey = "XF-APIKEY"
+	AuthSchemeHMAC   = "XF-HMAC-SHA256"
+)
+
+// ServiceKey is a credential of an internal caller.
+type ServiceKey struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+	// Service is the name of caller. It becomes Principal.ID. ID is used if empty.
+	Service     string   `json:"service"`
+	Tenant      string   `json:"tenant,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+	// HMACOnly forbids using the key as a plain API key.
+	HMACOnly bool `json:"hmac_only,omitempty"`
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// Principal creates a service principal of the key.
+// Claims use the same names as JWT, so Auth2JSON works for both.
+func (r *ServiceKey) Principal() *Principal {
+	id := r.Service
+	if id == "" {
+		id = r.ID
+	}
+	return &Principal{
+		ID:          id,
+		Kind:        PrincipalKindService,
+		Tenant:      r.Tenant,
+		Roles:       r.Roles,
+		Permissions: r.Permissions,
+		Claims: map[string]any{
+			ClaimSubject:     id,
+			ClaimTenant:      r.Tenant,
+			ClaimRoles:       r.Roles,
+			ClaimPermissions: r.Permissions,
+		},
+	}
+}
+
+// KeyStore looks up service keys by key id.
+type KeyStore interface {
+	Lookup(keyID string) (*ServiceKey, bool)
+}
+
+// StaticKeyStore is a KeyStore in memory. It's safe for concurrent use.
+type StaticKeyStore struct {
+	lock sync.RWMutex
+	keys map[string]*ServiceKey
+}
+
+func NewStaticKeyStore(keys ...*ServiceKey) *StaticKeyStore {
+	s := &StaticKeyStore{}
+	s.Replace(keys...)
+	return s
+}
+
+// MustLoadKeyStoreFile loads a JSON array of ServiceKey from file.
+func MustLoadKeyStoreFile(file string) *StaticKeyStore {
+	s := NewStaticKeyStore()
+	s.MustReloadFile(file)
+	return s
+}
+
+// MustReloadFile replaces all keys with the JSON array of ServiceKey in file.
+func (r *StaticKeyStore) MustReloadFile(file string) {
+	bytes, err := os.ReadFile(file)
+	if err != nil {
+		panic(ErrServerInternalError(fmt.Errorf("failed to read key store file %v. %v", file, err)))
+	}
+
+	var keys []*ServiceKey
+	if err = json.Unmarshal(bytes, &keys); err != nil {
+		panic(ErrUnmarshalJSONError(err))
+	}
+
+	r.Replace(keys...)
+}
+
+// Replace replaces all keys. Keys without ID or Secret are ignored.
+func (r *StaticKeyStore) Replace(keys ...*ServiceKey) {
+	m := make(map[string]*ServiceKey, len(keys))
+	for _, k := range keys {
+		if k != nil && k.ID != "" && k.Secret != "" {
+			m[k.ID] = k
+		}
+	}
+	r.lock.Lock()
+	r.keys = m
+	r.lock.Unlock()
+}
+
+func (r *StaticKeyStore) Lookup(keyID string) (*ServiceKey, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	k, ok := r.keys[keyID]
+	return k, ok
+}
+
+// NonceStore remembers nonces to prevent replay.
+type NonceStore interface {
+	// Remember returns false if nonce has been remembered and not expired.
+	Remember(nonce string, ttl time.Duration) bool
+}
+
+// MemoryNonceStore is a NonceStore in memory. Use a shared store such as redis if there are multiple instances.
+type MemoryNonceStore struct {
+	lock      sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: map[string]time.Time{}}
+}
+
+func (r *MemoryNonceStore) Remember(nonce string, ttl time.Duration) bool {
+	now := time.Now()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// sweep expired nonces at most once per ttl.
+	if now.Sub(r.lastSweep) > ttl {
+		for k, exp := range r.nonces {
+			if now.After(exp) {
+				delete(r.nonces, k)
+			}
+		}
+		r.lastSweep = now
+	}
+
+	if exp, ok := r.nonces[nonce]; ok && now.Before(exp) {
+		return false
+	}
+	r.nonces[nonce] = now.Add(ttl)
+	return true
+}
+
+// ServiceAuthenticator authenticates internal callers by API key or HMAC-signed request.
+type ServiceAuthenticator struct {
+	Keys KeyStore
+	// Nonces is required by HMAC. Default is an in-memory store.
+	Nonces NonceStore
+	// MaxClockSkew is the allowed difference between ts and now. Default is 5 minutes.
+	MaxClockSkew time.Duration
+	// DisableAPIKey only accepts HMAC-signed requests.
+	DisableAPIKey bool
+	// Required rejects requests without service credentials.
+	// If false, such requests are passed on without principal, for example to be authenticated by JWT.
+	// Claims of JWT are not trusted before verified, the verifier sets principal by SetVerifiedClaims or ContextWithPrincipal.
+	Required bool
+	// MaxBodySize is the max size of http body to be signed. Default is 10MB.
+	MaxBodySize int64
+}
+
+func NewServiceAuthenticator(keys KeyStore) *ServiceAuthenticator {
+	return &ServiceAuthenticator{
+		Keys:         keys,
+		Nonces:       NewMemoryNonceStore(),
+		MaxClockSkew: 5 * time.Minute,
+		MaxBodySize:  10 << 20,
+	}
+}
+
+var errNoServiceCredential = errors.New("No service credential.")
+var errInvalidServiceCredential = errors.New("Invalid service credential.")
+
+// IsServiceAuthorization returns true if authorization uses one of the service schemes.
+func IsServiceAuthorization(authorization string) bool {
+	return strings.HasPrefix(authorization, AuthSchemeAPIKey+" ") || strings.HasPrefix(authorization, AuthSchemeHMAC+" ")
+}
+
+// authenticate verifies authorization. signed returns the string to sign of the request.
+func (r *ServiceAuthenticator) authenticate(authorization string, signed func(ts, nonce string) (string, error)) (*Principal, ErrorType) {
+	switch {
+	case strings.HasPrefix(authorization, AuthSchemeAPIKey+" "):
+		if r.DisableAPIKey {
+			return nil, ErrUnauthorized(errInvalidServiceCredential)
+		}
+		return r.authenticateAPIKey(strings.TrimSpace(authorization[len(AuthSchemeAPIKey)+1:]))
+	case strings.HasPrefix(authorization, AuthSchemeHMAC+" "):
+		return r.authenticateHMAC(authorization[len(AuthSchemeHMAC)+1:], signed)
+	}
+	return nil, ErrUnauthorized(errNoServiceCredential)
+}
+
+// lookupKey returns enabled key of id. Keys with empty secret are never valid, whatever the KeyStore is.
+func (r *ServiceAuthenticator) lookupKey(id string) (*ServiceKey, bool) {
+	if r.Keys == nil {
+		return nil, false
+	}
+	key, ok := r.Keys.Lookup(id)
+	if !ok || key == nil || key.Disabled || key.Secret == "" {
+		return nil, false
+	}
+	return key, true
+}
+
+func (r *ServiceAuthenticator) authenticateAPIKey(credential string) (*Principal, ErrorType) {
+	id, secret, ok := strings.Cut(credential, ":")
+	if !ok || secret == "" {
+		return nil, ErrUnauthorized(errInvalidServiceCredential)
+	}
+
+	key, ok := r.lookupKey(id)
+	if !ok || key.HMACOnly || subtle.ConstantTimeCompare([]byte(secret), []byte(key.Secret)) != 1 {
+		return nil, ErrUnauthorized(errInvalidServiceCredential)
+	}
+
+	return key.Principal(), nil
+}
+
+func (r *ServiceAuthenticator) authenticateHMAC(params string, signed func(ts, nonce string) (string, error)) (*Principal, ErrorType) {
+	p := map[string]string{}
+	for _, kv := range strings.Split(params, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		p[k] = v
+	}
+
+	id, ts, nonce, signature := p["keyId"], p["ts"], p["nonce"], p["signature"]
+	if id == "" || ts == "" || nonce == "" || signature == "" {
+		return nil, ErrUnauthorized(errInvalidServiceCredential)
+	}
+
+	key, ok := r.lookupKey(id)
+	if !ok {
+		return nil, ErrUnauthorized(errInvalidServiceCredential)
+	}
+
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrUnauthorized(errInvalidServiceCredential)
+	}
+
+	skew := r.MaxClockSkew
+	if skew <= 0 {
+		skew = 5 * time.Minute
+	}
+
+	if d := time.Since(time.Unix(sec, 0)); d > skew || d < -skew {
+		return nil, ErrUnauthorized("Request timestamp is out of range.")
+	}
+
+	toSign, err := signed(ts, nonce)
+	if err != nil {
+		return nil, ErrUnauthorized(err)
+	}
+
+	expected := HMACSign(key.Secret, toSign)
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(expected)) != 1 {
+		return nil, ErrUnauthorized(errInvalidServiceCredential)
+	}
+
+	// remember nonce only after signature is verified, so that nobody can burn a nonce of others.
+	nonces := r.Nonces
+	if nonces == nil {
+		return nil, ErrServerInternalError("NonceStore of ServiceAuthenticator is nil.")
+	}
+	if !nonces.Remember(id+":"+nonce, 2*skew) {
+		return nil, ErrUnauthorized("Replayed request.")
+	}
+
+	return key.Principal(), nil
+}
+
+// HMACSign returns base64 encoded HMAC-SHA256 of message.
+func HMACSign(secret, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// HMACAuthorization returns the value of Authorization header of a HMAC-signed request.
+func HMACAuthorization(keyID, secret, ts, nonce, toSign string) string {
+	return fmt.Sprintf("%s keyId=%s,ts=%s,nonce=%s,signature=%s", AuthSchemeHMAC, keyID, ts, nonce, HMACSign(secret, toSign))
+}
+
+// APIKeyAuthorization returns the value of Authorization header of an API key.
+func APIKeyAuthorization(keyID, secret string) string {
+	return AuthSchemeAPIKey + " " + keyID + ":" + secret
+}
+
+func httpStringToSign(method, requestURI, ts, nonce string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{method, requestURI, ts, nonce, hex.EncodeToString(sum[:])}, "\n")
+}
+
+func grpcStringToSign(fullMethod, ts, nonce string, message []byte) string {
+	sum := sha256.Sum256(message)
+	return strings.Join([]string{fullMethod, ts, nonce, hex.EncodeToString(sum[:])}, "\n")
+}
+
+// grpcMessageToSign marshals req deterministically. Returns nil if req is not a protobuf message, e.g. of streams.
+func grpcMessageToSign(req any) ([]byte, error) {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return nil, nil
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(m)
+}
+
+// SignHTTPRequest signs req with HMAC. Body of req is read and restored.
+func SignHTTPRequest(req *http.Request, keyID, secret string) error {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := ShortUUID(32)
+	toSign := httpStringToSign(req.Method, req.URL.RequestURI(), ts, nonce, body)
+	req.Header.Set("Authorization", HMACAuthorization(keyID, secret, ts, nonce, toSign))
+	return nil
+}
+
+// GinMiddleware authenticates service credentials and sets principal of CTX.
+// Put it after xf.GinMiddleware().
+func (r *ServiceAuthenticator) GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorization := c.GetHeader("Authorization")
+
+		if !IsServiceAuthorization(authorization) {
+			if r.Required {
+				respondError(c, ErrUnauthorized(errNoServiceCredential))
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		principal, et := r.authenticate(authorization, func(ts, nonce string) (string, error) {
+			body, err := r.readBody(c)
+			if err != nil {
+				return "", err
+			}
+			return httpStringToSign(c.Request.Method, c.Request.URL.RequestURI(), ts, nonce, body), nil
+		})
+
+		if et != nil {
+			respondError(c, et)
+			c.Abort()
+			return
+		}
+
+		getCTX(c).SetPrincipal(principal)
+		c.Next()
+	}
+}
+
+// readBody reads body for verifying signature and restores it for handlers.
+func (r *ServiceAuthenticator) readBody(c *gin.Context) ([]byte, error) {
+	if c.Request.Body == nil {
+		return nil, nil
+	}
+
+	limit := r.MaxBodySize
+	if limit <= 0 {
+		limit = 10 << 20
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, errors.New("Request body is too large to be verified.")
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+type principalContextKey struct{}
+
+// ContextWithPrincipal returns a context.Context carrying principal.
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// PrincipalFromContext returns principal set by ContextWithPrincipal. Returns nil if not found.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalContextKey{}).(*Principal)
+	return p
+}
+
+// authenticateGRPC verifies credential of the call. req is nil for streams.
+func (r *ServiceAuthenticator) authenticateGRPC(ctx context.Context, fullMethod string, req any) (context.Context, error) {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			authorization = v[0]
+		}
+	}
+
+	if !IsServiceAuthorization(authorization) {
+		if r.Required {
+			return nil, status.Error(codes.Unauthenticated, errNoServiceCredential.Error())
+		}
+		return ctx, nil
+	}
+
+	principal, et := r.authenticate(authorization, func(ts, nonce string) (string, error) {
+		message, err := grpcMessageToSign(req)
+		if err != nil {
+			return "", err
+		}
+		return grpcStringToSign(fullMethod, ts, nonce, message), nil
+	})
+
+	if et != nil {
+		return nil, status.Error(codes.Unauthenticated, et.Error())
+	}
+
+	return ContextWithPrincipal(ctx, principal), nil
+}
+
+// UnaryServerInterceptor authenticates service credentials in grpc metadata "authorization".
+// Principal can be got by PrincipalFromContext or CTX created by NewCTXWithGRPCContext.
+func (r *ServiceAuthenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := r.authenticateGRPC(ctx, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the stream version of UnaryServerInterceptor.
+func (r *ServiceAuthenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := r.authenticateGRPC(ss.Context(), info.FullMethod, nil)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// contextServerStream overrides context of grpc.ServerStream.
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (r *contextServerStream) Context() context.Context {
+	return r.ctx
+}
+
+// grpcAuthorization returns credential of a call. req is nil for streams.
+func grpcAuthorization(keyID, secret, fullMethod string, req any, useHMAC bool) (string, error) {
+	if !useHMAC {
+		return APIKeyAuthorization(keyID, secret), nil
+	}
+	message, err := grpcMessageToSign(req)
+	if err != nil {
+		return "", err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := ShortUUID(32)
+	return HMACAuthorization(keyID, secret, ts, nonce, grpcStringToSign(fullMethod, ts, nonce, message)), nil
+}
+
+// ServiceAuthUnaryClientInterceptor attaches service credentials to every grpc call.
+// useHMAC signs each call with its message, otherwise the API key is sent.
+func ServiceAuthUnaryClientInterceptor(keyID, secret string, useHMAC bool) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		authorization, err := grpcAuthorization(keyID, secret, method, req, useHMAC)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", authorization)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// ServiceAuthStreamClientInterceptor is the stream version of ServiceAuthUnaryClientInterceptor.
+func ServiceAuthStreamClientInterceptor(keyID, secret string, useHMAC bool) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		authorization, err := grpcAuthorization(keyID, secret, method, nil, useHMAC)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", authorization)
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
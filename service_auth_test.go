@@ -0,0 +1,168 @@
+package xf
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func newTestServiceAuthenticator() *ServiceAuthenticator {
+	return NewServiceAuthenticator(NewStaticKeyStore(
+		&ServiceKey{ID: "order", Secret: "s3cret", Service: "order-service"},
+		&ServiceKey{ID: "hmac", Secret: "s3cret", HMACOnly: true},
+		&ServiceKey{ID: "off", Secret: "s3cret", Disabled: true},
+		&ServiceKey{ID: "empty"},
+	))
+}
+
+// emptySecretKeyStore returns keys as they are, unlike StaticKeyStore.
+type emptySecretKeyStore struct{}
+
+func (emptySecretKeyStore) Lookup(keyID string) (*ServiceKey, bool) {
+	return &ServiceKey{ID: keyID}, true
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		credential string
+		ok         bool
+	}{
+		{"valid", "order:s3cret", true},
+		{"bad secret", "order:wrong", false},
+		{"empty presented secret", "order:", false},
+		{"no separator", "order", false},
+		{"unknown key", "nobody:s3cret", false},
+		{"hmac only", "hmac:s3cret", false},
+		{"disabled", "off:s3cret", false},
+		{"empty key secret", "empty:", false},
+	}
+
+	auth := newTestServiceAuthenticator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, et := auth.authenticateAPIKey(tt.credential)
+			if tt.ok != (et == nil) {
+				t.Fatalf("err = %v, want ok %v", et, tt.ok)
+			}
+			if tt.ok && p.ID != "order-service" {
+				t.Fatalf("principal = %v", p.ID)
+			}
+		})
+	}
+
+	// a KeyStore returning keys with empty secret
+	auth.Keys = emptySecretKeyStore{}
+	if _, et := auth.authenticateAPIKey("any:"); et == nil {
+		t.Fatal("empty secret authenticated")
+	}
+}
+
+func TestAuthenticateHMAC(t *testing.T) {
+	now := time.Now().Unix()
+	toSign := func(ts, nonce string) (string, error) {
+		return "POST\n/orders\n" + ts + "\n" + nonce, nil
+	}
+	params := func(keyID, secret string, ts int64, nonce, signedBody string) string {
+		tss := strconv.FormatInt(ts, 10)
+		s, _ := toSign(tss, nonce)
+		return HMACAuthorization(keyID, secret, tss, nonce, s+signedBody)[len(AuthSchemeHMAC)+1:]
+	}
+
+	tests := []struct {
+		name   string
+		params string
+		ok     bool
+	}{
+		{"valid", params("order", "s3cret", now, "n1", ""), true},
+		{"hmac only key", params("hmac", "s3cret", now, "n2", ""), true},
+		{"reused nonce", params("order", "s3cret", now, "n1", ""), false},
+		{"expired ts", params("order", "s3cret", now-3600, "n3", ""), false},
+		{"future ts", params("order", "s3cret", now+3600, "n4", ""), false},
+		{"bad signature", params("order", "wrong", now, "n5", ""), false},
+		{"tampered request", params("order", "s3cret", now, "n6", "tampered"), false},
+		{"disabled key", params("off", "s3cret", now, "n7", ""), false},
+		{"empty key secret", params("empty", "", now, "n8", ""), false},
+		{"missing nonce", params("order", "s3cret", now, "", ""), false},
+		{"malformed", "keyId=order", false},
+	}
+
+	auth := newTestServiceAuthenticator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, et := auth.authenticateHMAC(tt.params, toSign)
+			if tt.ok != (et == nil) {
+				t.Fatalf("err = %v, want ok %v", et, tt.ok)
+			}
+		})
+	}
+
+	t.Run("nonce burnt only by valid signature", func(t *testing.T) {
+		if _, et := auth.authenticateHMAC(params("order", "wrong", now, "n9", ""), toSign); et == nil {
+			t.Fatal("bad signature authenticated")
+		}
+		if _, et := auth.authenticateHMAC(params("order", "s3cret", now, "n9", ""), toSign); et != nil {
+			t.Fatal(et)
+		}
+	})
+}
+
+func TestAuthenticateGRPCSignsMessage(t *testing.T) {
+	auth := newTestServiceAuthenticator()
+	const method = "/xf.crud.v1.Order/Get"
+
+	req, _ := structpb.NewStruct(map[string]any{"id": "1"})
+	var authorization string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		authorization = md.Get("authorization")[0]
+		return nil
+	}
+	if err := ServiceAuthUnaryClientInterceptor("order", "s3cret", true)(context.Background(), method, req, nil, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	incoming := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", authorization))
+
+	tampered, _ := structpb.NewStruct(map[string]any{"id": "2"})
+	if _, err := auth.authenticateGRPC(incoming, method, tampered); err == nil {
+		t.Fatal("tampered message authenticated")
+	}
+	ctx, err := auth.authenticateGRPC(incoming, method, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := PrincipalFromContext(ctx); p == nil || p.ID != "order-service" {
+		t.Fatalf("principal = %v", p)
+	}
+}
+
+func TestUnverifiedJWTHasNoPrincipal(t *testing.T) {
+	auth := newTestServiceAuthenticator()
+	// {"sub":"admin","permissions":["unmask"]}, not signed
+	forged := "Bearer eyJhbGciOiJub25lIn0.eyJzdWIiOiJhZG1pbiIsInBlcm1pc3Npb25zIjpbInVubWFzayJdfQ."
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.Header.Set("Authorization", forged)
+	auth.GinMiddleware()(c)
+	if p := getCTX(c).Principal(); p != nil {
+		t.Fatalf("principal = %v", p)
+	}
+
+	incoming := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", forged))
+	ctx, err := auth.authenticateGRPC(incoming, "/xf.crud.v1.Order/Get", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := PrincipalFromContext(ctx); p != nil {
+		t.Fatalf("principal = %v", p)
+	}
+}
@@ -0,0 +1,50 @@
+package xf
+
+import (
+	"reflect"
+	"testing"
+)
+
+type searchTestModel struct {
+	CommonFields `bson:",inline"`
+	Name         string `bson:"name" xf:"search:text"`
+	Code         string `bson:"code" xf:"search"`
+}
+
+func TestParseXFTagWithTextSearch(t *testing.T) {
+	_, searchable, text, _, _, _ := ParseXFTagWithTextSearch(searchTestModel{}, "bson")
+	if !reflect.DeepEqual(searchable, []string{"name", "code"}) {
+		t.Fatalf("searchable = %v", searchable)
+	}
+	if !reflect.DeepEqual(text, []string{"name"}) {
+		t.Fatalf("text = %v", text)
+	}
+}
+
+func TestFixSearchParameters(t *testing.T) {
+	keyword := &CommonSvc[searchTestModel, *searchTestModel]{KeywordToFields: []string{"code"}}
+	none := &CommonSvc[searchTestModel, *searchTestModel]{}
+
+	tests := []struct {
+		name   string
+		svc    *CommonSvc[searchTestModel, *searchTestModel]
+		page   PageMeta
+		panics bool
+	}{
+		{"invalid mode without text", keyword, PageMeta{SearchMode: "bad"}, false},
+		{"invalid mode without searchable fields", none, PageMeta{SearchMode: "bad", SearchText: "a"}, false},
+		{"invalid mode", keyword, PageMeta{SearchMode: "bad", SearchText: "a"}, true},
+		{"text mode without text index", keyword, PageMeta{SearchMode: SearchModeText, SearchText: "a"}, true},
+		{"default mode", keyword, PageMeta{SearchText: "a"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if err := recover(); (err != nil) != tt.panics {
+					t.Fatalf("panic = %v, want panic %v", err, tt.panics)
+				}
+			}()
+			tt.svc.fixSearchParameters(&tt.page)
+		})
+	}
+}
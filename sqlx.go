@@ -1,6 +1,7 @@
 package xf
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"runtime"
@@ -8,90 +9,226 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 var SlowSQLDuration = time.Millisecond * 100
 var VerySlowSQLDuration = time.Second
 
 func NewDBXWithLogger(dbx *sqlx.DB, traceID string, file string) *DBXWithLogger {
-	return &DBXWithLogger{DB: dbx, traceID: traceID, file: file}
+	return &DBXWithLogger{DB: dbx, traceID: traceID, file: file, logger: CurrentLogger().With(zap.String(LogFieldTraceID, traceID))}
 }
 
 type DBXWithLogger struct {
 	*sqlx.DB
 	traceID string
 	file    string
+	// ctx carries span, deadline and cancellation of CTX. See NewDBXWithCTX.
+	ctx    context.Context
+	logger *zap.Logger
 }
 
-func (o *DBXWithLogger) Query(query string, args ...interface{}) (*sql.Rows, error) {
+// NewDBXWithCTX traces queries as child spans of CTX. Queries are canceled when CTX is done.
+func NewDBXWithCTX(dbx *sqlx.DB, ctx *CTX, file string) *DBXWithLogger {
+	return &DBXWithLogger{DB: dbx, traceID: ctx.TraceID(), file: file, ctx: ctx, logger: ctx.Logger()}
+}
+
+// context returns CTX of NewDBXWithCTX, or context.Background().
+func (o *DBXWithLogger) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+func (o *DBXWithLogger) Query(query string, args ...interface{}) (result *sql.Rows, err error) {
+	return o.QueryContext(o.context(), query, args...)
+}
+
+func (o *DBXWithLogger) QueryContext(ctx context.Context, query string, args ...interface{}) (result *sql.Rows, err error) {
 	begin := time.Now()
-	defer SQLTrace(o.traceID, o.file, begin, query, args...)
-	return o.DB.Query(query, args...)
+	ctx, span := startSQLSpan(ctx, o.traceID, query)
+	defer func() {
+		span.End()
+		traceSQL(o.logger, o.file, begin, err, query, args...)
+	}()
+	return o.DB.QueryContext(ctx, query, args...)
 }
 
-func (o *DBXWithLogger) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+func (o *DBXWithLogger) Queryx(query string, args ...interface{}) (result *sqlx.Rows, err error) {
+	return o.QueryxContext(o.context(), query, args...)
+}
+
+func (o *DBXWithLogger) QueryxContext(ctx context.Context, query string, args ...interface{}) (result *sqlx.Rows, err error) {
 	begin := time.Now()
-	defer SQLTrace(o.traceID, o.file, begin, query, args...)
-	return o.DB.Queryx(query, args...)
+	ctx, span := startSQLSpan(ctx, o.traceID, query)
+	defer func() {
+		span.End()
+		traceSQL(o.logger, o.file, begin, err, query, args...)
+	}()
+	return o.DB.QueryxContext(ctx, query, args...)
 }
 
-func (o *DBXWithLogger) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+func (o *DBXWithLogger) QueryRowx(query string, args ...interface{}) (row *sqlx.Row) {
+	return o.QueryRowxContext(o.context(), query, args...)
+}
+
+func (o *DBXWithLogger) QueryRowxContext(ctx context.Context, query string, args ...interface{}) (row *sqlx.Row) {
 	begin := time.Now()
-	defer SQLTrace(o.traceID, o.file, begin, query, args...)
-	return o.DB.QueryRowx(query, args...)
+	ctx, span := startSQLSpan(ctx, o.traceID, query)
+	defer func() {
+		span.End()
+		traceSQL(o.logger, o.file, begin, row.Err(), query, args...)
+	}()
+	return o.DB.QueryRowxContext(ctx, query, args...)
+}
+
+func (o *DBXWithLogger) Exec(query string, args ...interface{}) (result sql.Result, err error) {
+	return o.ExecContext(o.context(), query, args...)
 }
 
-func (o *DBXWithLogger) Exec(query string, args ...interface{}) (sql.Result, error) {
+func (o *DBXWithLogger) ExecContext(ctx context.Context, query string, args ...interface{}) (result sql.Result, err error) {
 	begin := time.Now()
-	defer SQLTrace(o.traceID, o.file, begin, query, args...)
-	return o.DB.Exec(query, args...)
+	ctx, span := startSQLSpan(ctx, o.traceID, query)
+	defer func() {
+		span.End()
+		traceSQL(o.logger, o.file, begin, err, query, args...)
+	}()
+	return o.DB.ExecContext(ctx, query, args...)
 }
 
 func NewTXXWithLogger(txx *sqlx.Tx, traceID string, file string) *TXXWithLogger {
-	return &TXXWithLogger{Tx: txx, traceID: traceID, file: file}
+	return &TXXWithLogger{Tx: txx, traceID: traceID, file: file, logger: CurrentLogger().With(zap.String(LogFieldTraceID, traceID))}
 }
 
 type TXXWithLogger struct {
 	*sqlx.Tx
 	traceID string
 	file    string
+	// ctx carries span, deadline and cancellation of CTX. See NewTXXWithCTX.
+	ctx    context.Context
+	logger *zap.Logger
+}
+
+// NewTXXWithCTX traces queries as child spans of CTX. Queries are canceled when CTX is done.
+func NewTXXWithCTX(txx *sqlx.Tx, ctx *CTX, file string) *TXXWithLogger {
+	return &TXXWithLogger{Tx: txx, traceID: ctx.TraceID(), file: file, ctx: ctx, logger: ctx.Logger()}
 }
 
-func (o *TXXWithLogger) Query(query string, args ...interface{}) (*sql.Rows, error) {
+// context returns CTX of NewTXXWithCTX, or context.Background().
+func (o *TXXWithLogger) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+	return o.ctx
+}
+
+func (o *TXXWithLogger) Query(query string, args ...interface{}) (result *sql.Rows, err error) {
+	return o.QueryContext(o.context(), query, args...)
+}
+
+func (o *TXXWithLogger) QueryContext(ctx context.Context, query string, args ...interface{}) (result *sql.Rows, err error) {
 	begin := time.Now()
-	defer SQLTrace(o.traceID, o.file, begin, query, args...)
-	return o.Tx.Query(query, args...)
+	ctx, span := startSQLSpan(ctx, o.traceID, query)
+	defer func() {
+		span.End()
+		traceSQL(o.logger, o.file, begin, err, query, args...)
+	}()
+	return o.Tx.QueryContext(ctx, query, args...)
+}
+
+func (o *TXXWithLogger) Queryx(query string, args ...interface{}) (result *sqlx.Rows, err error) {
+	return o.QueryxContext(o.context(), query, args...)
 }
 
-func (o *TXXWithLogger) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+func (o *TXXWithLogger) QueryxContext(ctx context.Context, query string, args ...interface{}) (result *sqlx.Rows, err error) {
 	begin := time.Now()
-	defer SQLTrace(o.traceID, o.file, begin, query, args...)
-	return o.Tx.Queryx(query, args...)
+	ctx, span := startSQLSpan(ctx, o.traceID, query)
+	defer func() {
+		span.End()
+		traceSQL(o.logger, o.file, begin, err, query, args...)
+	}()
+	return o.Tx.QueryxContext(ctx, query, args...)
+}
+
+func (o *TXXWithLogger) QueryRowx(query string, args ...interface{}) (row *sqlx.Row) {
+	return o.QueryRowxContext(o.context(), query, args...)
 }
 
-func (o *TXXWithLogger) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+func (o *TXXWithLogger) QueryRowxContext(ctx context.Context, query string, args ...interface{}) (row *sqlx.Row) {
 	begin := time.Now()
-	defer SQLTrace(o.traceID, o.file, begin, query, args...)
-	return o.Tx.QueryRowx(query, args...)
+	ctx, span := startSQLSpan(ctx, o.traceID, query)
+	defer func() {
+		span.End()
+		traceSQL(o.logger, o.file, begin, row.Err(), query, args...)
+	}()
+	return o.Tx.QueryRowxContext(ctx, query, args...)
 }
 
-func (o *TXXWithLogger) Exec(query string, args ...interface{}) (sql.Result, error) {
+func (o *TXXWithLogger) Exec(query string, args ...interface{}) (result sql.Result, err error) {
+	return o.ExecContext(o.context(), query, args...)
+}
+
+func (o *TXXWithLogger) ExecContext(ctx context.Context, query string, args ...interface{}) (result sql.Result, err error) {
 	begin := time.Now()
-	defer SQLTrace(o.traceID, o.file, begin, query, args...)
-	return o.Tx.Exec(query, args...)
+	ctx, span := startSQLSpan(ctx, o.traceID, query)
+	defer func() {
+		span.End()
+		traceSQL(o.logger, o.file, begin, err, query, args...)
+	}()
+	return o.Tx.ExecContext(ctx, query, args...)
+}
+
+// startSQLSpan starts a span of query as child of parent. The span is no-op if parent has no span.
+func startSQLSpan(parent context.Context, traceID, query string) (context.Context, trace.Span) {
+	if !trace.SpanFromContext(parent).SpanContext().IsValid() {
+		return parent, trace.SpanFromContext(parent)
+	}
+	op, _ := sqlOperationAndTable(query)
+	return Tracer().Start(parent, "sql."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "sql"),
+			attribute.String("db.statement", query),
+			attribute.String(AttrTraceID, traceID),
+		))
+}
+
+// traceSQL records metrics and logs query.
+func traceSQL(logger *zap.Logger, file string, begin time.Time, err error, query string, args ...interface{}) {
+	operation, table := sqlOperationAndTable(query)
+	ObserveDAOOperation("sql", table, operation, time.Since(begin), err != nil && err != sql.ErrNoRows)
+	logSQL(logger, file, begin, query, args...)
 }
 
 func SQLTrace(traceID, file string, begin time.Time, sql string, args ...interface{}) {
+	logSQL(CurrentLogger().With(zap.String(LogFieldTraceID, traceID)), file, begin, sql, args...)
+}
+
+// logSQL logs query at debug level, or warn level if slower than VerySlowSQLDuration.
+func logSQL(logger *zap.Logger, file string, begin time.Time, sql string, args ...interface{}) {
+	if logger == nil {
+		logger = CurrentLogger()
+	}
 	elapsed := time.Since(begin)
-	slowTag := ""
+
+	level, msg := zapcore.DebugLevel, sql
 	if elapsed >= VerySlowSQLDuration {
-		slowTag = " [VERY SLOW SQL]"
-		Warnf("[%s] %s\n[%vms]%s %v; args=%v", traceID, file, float64(elapsed.Nanoseconds())/1e6, slowTag, sql, args)
-	} else {
-		if elapsed >= SlowSQLDuration {
-			slowTag = " [SLOW SQL]"
-		}
-		Debugf("[%s] %s\n[%vms]%s %v; args=%v", traceID, file, float64(elapsed.Nanoseconds())/1e6, slowTag, sql, args)
+		level, msg = zapcore.WarnLevel, "[VERY SLOW SQL] "+sql
+	} else if elapsed >= SlowSQLDuration {
+		msg = "[SLOW SQL] " + sql
+	}
+
+	// redacting args parses the query, so only when it's logged.
+	if ce := logger.Check(level, msg); ce != nil {
+		ce.Write(
+			zap.String("file", file),
+			zap.Float64("elapsed_ms", float64(elapsed.Nanoseconds())/1e6),
+			zap.Any("args", Redaction().SQLArgs(sql, args)),
+		)
 	}
 }
 
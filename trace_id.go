@@ -0,0 +1,161 @@
+package xf
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// TraceIDSource is where an incoming trace ID is read from.
+type TraceIDSource string
+
+const (
+	// TraceIDSourceRequestID is header X-Request-ID, set by gateways and load balancers.
+	TraceIDSourceRequestID TraceIDSource = "x-request-id"
+	// TraceIDSourceTID is header (or grpc metadata) tid, set by services of xf.
+	TraceIDSourceTID TraceIDSource = "tid"
+	// TraceIDSourceTraceparent is the trace-id of W3C traceparent, so that tid is the same as the trace of spans.
+	TraceIDSourceTraceparent TraceIDSource = "traceparent"
+)
+
+// TraceIDSources are tried in order to resolve the trace ID of an incoming http request or grpc call.
+// A new one is created by UUID12 if none is found. Set it to nil to never trust incoming IDs.
+var TraceIDSources = []TraceIDSource{TraceIDSourceTID, TraceIDSourceRequestID, TraceIDSourceTraceparent}
+
+// TraceIDResponseHeader echoes the trace ID in http responses. Empty disables it.
+var TraceIDResponseHeader = "X-Request-ID"
+
+// TraceIDOutgoingHeaders carry the trace ID in outbound http requests. See TraceIDRoundTripper.
+var TraceIDOutgoingHeaders = []string{"X-Request-ID", "tid"}
+
+// maxTraceIDLength bounds incoming trace IDs, which are written to every log.
+const maxTraceIDLength = 64
+
+// resolveTraceID returns the first valid trace ID by TraceIDSources, or a new one. get returns the value of a header.
+func resolveTraceID(get func(key string) string) string {
+	for _, source := range TraceIDSources {
+		v := strings.TrimSpace(get(string(source)))
+		if source == TraceIDSourceTraceparent {
+			v = traceIDOfTraceparent(v)
+		}
+		if isValidTraceID(v) {
+			return v
+		}
+	}
+	return UUID12()
+}
+
+// traceIDOfTraceparent returns trace-id of "00-<trace-id>-<parent-id>-<flags>". Returns "" if it's malformed.
+func traceIDOfTraceparent(traceparent string) string {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	return parts[1]
+}
+
+// isValidTraceID accepts IDs of letters, digits and -_.: only, so that logs can't be forged.
+func isValidTraceID(traceID string) bool {
+	if traceID == "" || len(traceID) > maxTraceIDLength {
+		return false
+	}
+	for _, r := range traceID {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' || r == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveTraceIDFromMD resolves trace ID of incoming grpc metadata by TraceIDSources.
+func resolveTraceIDFromMD(md metadata.MD) string {
+	return resolveTraceID(func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	})
+}
+
+// traceIDOfOutgoingContext returns tid of CTX in ctx, or of the incoming call. Returns "" if not found.
+func traceIDOfOutgoingContext(ctx context.Context) string {
+	if c, ok := ctx.Value(ctxContextKey{}).(*CTX); ok {
+		return c.TraceID()
+	}
+	return TraceIDFromIncoming(ctx)
+}
+
+// contextWithOutgoingTraceID appends tid to outgoing metadata if it's missing.
+func contextWithOutgoingTraceID(ctx context.Context) context.Context {
+	if TraceIDFromOutgoing(ctx) != "" {
+		return ctx
+	}
+	if traceID := traceIDOfOutgoingContext(ctx); traceID != "" {
+		return ContextByAppendingTraceID(ctx, traceID)
+	}
+	return ctx
+}
+
+// TraceIDUnaryClientInterceptor attaches tid to outgoing metadata, from CTX in context (see ContextWithCTX)
+// or from the incoming call being served. So that handlers of grpc servers can pass their context as it is.
+func TraceIDUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(contextWithOutgoingTraceID(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// TraceIDStreamClientInterceptor is the stream version of TraceIDUnaryClientInterceptor.
+func TraceIDStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(contextWithOutgoingTraceID(ctx), desc, cc, method, opts...)
+	}
+}
+
+// TraceIDRoundTripper sets TraceIDOutgoingHeaders and traceparent of outbound http requests,
+// from CTX in the request's context. next defaults to http.DefaultTransport.
+//
+//	client := &http.Client{Transport: xf.TraceIDRoundTripper(nil)}
+//	req, _ := http.NewRequestWithContext(ctx.OutgoingContext(), "GET", url, nil)
+func TraceIDRoundTripper(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return traceIDRoundTripper{next: next}
+}
+
+type traceIDRoundTripper struct {
+	next http.RoundTripper
+}
+
+func (r traceIDRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	traceID := traceIDOfOutgoingContext(req.Context())
+	if traceID == "" {
+		return r.next.RoundTrip(req)
+	}
+
+	// RoundTripper must not modify the request.
+	req = req.Clone(req.Context())
+	for _, h := range TraceIDOutgoingHeaders {
+		if req.Header.Get(h) == "" {
+			req.Header.Set(h, traceID)
+		}
+	}
+
+	ctx := req.Context()
+	if c, ok := ctx.Value(ctxContextKey{}).(*CTX); ok && !trace.SpanContextFromContext(ctx).IsValid() {
+		// span of CTX, in case the request's context is not derived from it.
+		ctx = c.Context()
+	}
+	TracePropagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return r.next.RoundTrip(req)
+}
+
+// OutgoingContext returns Context carrying CTX, for outbound calls. See TraceIDRoundTripper and TraceIDUnaryClientInterceptor.
+func (c *CTX) OutgoingContext() context.Context {
+	return ContextWithCTX(c.Context(), c)
+}
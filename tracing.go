@@ -0,0 +1,290 @@
+package xf
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AttrTraceID is the span attribute of CTX.TraceID.
+const AttrTraceID = "tid"
+
+// TracePropagator propagates W3C traceparent and baggage. It works even if tracing is not configured.
+var TracePropagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Tracer returns the tracer of xf from the global TracerProvider. Spans are no-op until ConfigTracing.
+func Tracer() trace.Tracer {
+	return otel.Tracer(xfPackagePath)
+}
+
+// TracingConfig configures ConfigTracing.
+type TracingConfig struct {
+	ServiceName string
+	// Exporter of spans, e.g. NewStdoutTraceExporter, NewFileTraceExporter or an OTLP exporter.
+	Exporter sdktrace.SpanExporter
+	// SampleRatio of root spans in [0, 1]. Child spans follow their parents. 0 means 1.
+	SampleRatio float64
+	// Attributes of resource, e.g. attribute.String("deployment.environment", "prod").
+	Attributes []attribute.KeyValue
+}
+
+// ConfigTracing sets the global TracerProvider and propagator. Call the returned function on shutdown to flush spans.
+func ConfigTracing(cfg TracingConfig) (shutdown func(context.Context) error) {
+	ratio := cfg.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+
+	attrs := append([]attribute.KeyValue{attribute.String("service.name", cfg.ServiceName)}, cfg.Attributes...)
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(attrs...)),
+	}
+	if cfg.Exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(cfg.Exporter))
+	}
+
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(TracePropagator)
+
+	return tp.Shutdown
+}
+
+// NewStdoutTraceExporter writes spans as JSON lines to w. os.Stdout if w is nil.
+func NewStdoutTraceExporter(w io.Writer) sdktrace.SpanExporter {
+	if w == nil {
+		w = os.Stdout
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		panic(ErrServerInternalError(err))
+	}
+	return exporter
+}
+
+// NewFileTraceExporter appends spans as JSON lines to file. Useful offline.
+func NewFileTraceExporter(file string) sdktrace.SpanExporter {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		panic(ErrServerInternalError(fmt.Errorf("failed to open trace file %v. %v", file, err)))
+	}
+	return NewStdoutTraceExporter(f)
+}
+
+// StartSpan starts a span as child of CTX's context. CTX's context is not changed.
+func (c *CTX) StartSpan(name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, span := Tracer().Start(c.Context(), name, opts...)
+	span.SetAttributes(attribute.String(AttrTraceID, c.TraceID()))
+	return ctx, span
+}
+
+// EndSpan records err on span if it's a failure, and ends span.
+func EndSpan(span trace.Span, err any) {
+	if err != nil {
+		if et := TryConvertToErrorType(err); et != nil && et.StatusCode() < 500 {
+			span.SetAttributes(attribute.Int("error.status", et.StatusCode()))
+		} else {
+			span.SetStatus(otelcodes.Error, fmt.Sprintf("%v", err))
+		}
+		if e, ok := err.(error); ok {
+			span.RecordError(e)
+		}
+	}
+	span.End()
+}
+
+// startGinSpan starts server span of request, and stores it in CTX.
+func startGinSpan(c *gin.Context, ctx *CTX) trace.Span {
+	// derived from request context, so that DAO operations and outbound calls are canceled with the request.
+	// GinMiddleware detaches it when the request is done, see AutoRecoverAsync for jobs started by handlers.
+	parent := TracePropagator.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	spanCtx, span := Tracer().Start(parent, c.Request.Method+" "+route,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.method", c.Request.Method),
+			attribute.String("http.route", route),
+			attribute.String("http.target", c.Request.URL.Path),
+			attribute.String(AttrTraceID, ctx.TraceID()),
+		))
+
+	ctx.SetContext(spanCtx)
+	return span
+}
+
+func endGinSpan(c *gin.Context, span trace.Span) {
+	code := c.Writer.Status()
+	span.SetAttributes(attribute.Int("http.status_code", code))
+	if code >= 500 {
+		span.SetStatus(otelcodes.Error, fmt.Sprintf("status %d", code))
+	}
+	span.End()
+}
+
+// metadataCarrier adapts grpc metadata to propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+func (r metadataCarrier) Get(key string) string {
+	v := metadata.MD(r).Get(key)
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+func (r metadataCarrier) Set(key, value string) {
+	metadata.MD(r).Set(key, value)
+}
+
+func (r metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(r))
+	for k := range r {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func endGRPCSpan(span trace.Span, err error) {
+	if err != nil {
+		s, _ := status.FromError(err)
+		span.SetAttributes(attribute.String("rpc.grpc.status_code", s.Code().String()))
+		if GRPCCodeToHTTPStatus(s.Code()) >= 500 {
+			span.SetStatus(otelcodes.Error, s.Message())
+		}
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+func startGRPCServerSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = TracePropagator.Extract(ctx, metadataCarrier(md))
+	return Tracer().Start(ctx, fullMethod,
+		trace.WithSpanKind(trace.SpanKindServer),
+		// tid is set by CTXUnaryServerInterceptor
+		trace.WithAttributes(attribute.String("rpc.system", "grpc")))
+}
+
+func startGRPCClientSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	if c, ok := ctx.Value(ctxContextKey{}).(*CTX); ok && !trace.SpanContextFromContext(ctx).IsValid() {
+		// context created by CTX.FillGRPCContext with a parent without span
+		ctx = trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(c.Context()))
+	}
+
+	ctx, span := Tracer().Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String(AttrTraceID, TraceIDFromOutgoing(ctx)),
+		))
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	TracePropagator.Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// TracingUnaryServerInterceptor starts a server span with parent from incoming traceparent.
+func TracingUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		ctx, span := startGRPCServerSpan(ctx, info.FullMethod)
+		defer func() { endGRPCSpan(span, err) }()
+		return handler(ctx, req)
+	}
+}
+
+// TracingStreamServerInterceptor is the stream version of TracingUnaryServerInterceptor.
+func TracingStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx, span := startGRPCServerSpan(ss.Context(), info.FullMethod)
+		defer func() { endGRPCSpan(span, err) }()
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// TracingUnaryClientInterceptor starts a client span and injects traceparent to outgoing metadata.
+func TracingUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
+		ctx, span := startGRPCClientSpan(ctx, method)
+		defer func() { endGRPCSpan(span, err) }()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// TracingStreamClientInterceptor starts a client span lasting until the stream is created.
+func TracingStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (cs grpc.ClientStream, err error) {
+		ctx, span := startGRPCClientSpan(ctx, method)
+		defer func() { endGRPCSpan(span, err) }()
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+type mongoRequestKey struct {
+	connectionID string
+	requestID    int64
+}
+
+// MongoTracingMonitor creates a span for each mongo command, as child of the span in context of MongoDAO.
+// Set it by options.Client().SetMonitor(xf.MongoTracingMonitor()).
+func MongoTracingMonitor() *event.CommandMonitor {
+	var spans sync.Map
+
+	end := func(connectionID string, requestID int64, failure string) {
+		v, ok := spans.LoadAndDelete(mongoRequestKey{connectionID, requestID})
+		if !ok {
+			return
+		}
+		span := v.(trace.Span)
+		if failure != "" {
+			span.SetStatus(otelcodes.Error, failure)
+		}
+		span.End()
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			if !trace.SpanContextFromContext(ctx).IsValid() {
+				// not in a traced request
+				return
+			}
+			_, span := Tracer().Start(ctx, "mongo."+e.CommandName,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("db.system", "mongodb"),
+					attribute.String("db.name", e.DatabaseName),
+					attribute.String("db.operation", e.CommandName),
+				))
+			spans.Store(mongoRequestKey{e.ConnectionID, e.RequestID}, span)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			end(e.ConnectionID, e.RequestID, "")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			end(e.ConnectionID, e.RequestID, e.Failure)
+		},
+	}
+}